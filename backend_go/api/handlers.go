@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -8,8 +9,11 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go"
+
+	"bigdata-perf/metrics"
 )
 
 var dsn = "tcp://127.0.0.1:9000?debug=false"
@@ -23,6 +27,34 @@ func setSessionLimits(db *sql.DB) {
 	`)
 }
 
+// PingClickHouse runs SELECT 1 against ClickHouse, for readiness checks.
+func PingClickHouse(ctx context.Context) error {
+	db, err := sql.Open("clickhouse", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var one uint8
+	return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// observe records how long a handler spent querying and how many rows it
+// returned.
+func observe(handler string, start time.Time, rows int) {
+	metrics.APIQueryDuration.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+	metrics.APIRowsReturned.WithLabelValues(handler).Observe(float64(rows))
+}
+
+// countExpr returns the count expression of an aggregate query: the stored
+// row count, or with scaled=true an estimate of the events received, weighting
+// each row by the inverse of its sample rate.
+func countExpr(r *http.Request) string {
+	if scaled, _ := strconv.ParseBool(r.URL.Query().Get("scaled")); scaled {
+		return "toUInt64(round(sum(1 / sample_rate)))"
+	}
+	return "count()"
+}
+
 func OverviewHandler(w http.ResponseWriter, r *http.Request) {
 	db, err := sql.Open("clickhouse", dsn)
 	if err != nil {
@@ -32,8 +64,9 @@ func OverviewHandler(w http.ResponseWriter, r *http.Request) {
 	defer db.Close()
 	setSessionLimits(db)
 
+	start := time.Now()
 	row := db.QueryRow(`
-		SELECT count() AS total,
+		SELECT `+countExpr(r)+` AS total,
 		       uniq(user_id) AS unique_users,
 		       min(ts),
 		       max(ts)
@@ -84,6 +117,7 @@ func OverviewHandler(w http.ResponseWriter, r *http.Request) {
 		recent = append(recent, e)
 	}
 
+	observe("overview", start, len(recent))
 	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(map[string]any{
 		"total":        total,
@@ -130,6 +164,7 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	query += " ORDER BY ts DESC LIMIT ?"
 	args = append(args, limit)
 
+	start := time.Now()
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Query error: %v", err), 500)
@@ -156,6 +191,7 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		events = append(events, e)
 	}
+	observe("events", start, len(events))
 	json.NewEncoder(w).Encode(events)
 }
 
@@ -189,13 +225,14 @@ func TimeSeriesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	query := fmt.Sprintf(`
-		SELECT toStartOfInterval(ts, INTERVAL %s) AS bucket, count() as count
+		SELECT toStartOfInterval(ts, INTERVAL %s) AS bucket, %s as count
 		FROM analytics.page_events
 		WHERE ts BETWEEN parseDateTimeBestEffort(?) AND parseDateTimeBestEffort(?)
 		GROUP BY bucket
 		ORDER BY bucket ASC
-		LIMIT 1000`, interval)
+		LIMIT 1000`, interval, countExpr(r))
 
+	start := time.Now()
 	rows, err := db.Query(query, from, to)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -215,6 +252,7 @@ func TimeSeriesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	observe("time-series", start, len(points))
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(points)
@@ -229,8 +267,9 @@ func TypeBreakdownHandler(w http.ResponseWriter, r *http.Request) {
 	defer db.Close()
 	setSessionLimits(db)
 
+	start := time.Now()
 	rows, err := db.Query(`
-		SELECT event_type, count() as c
+		SELECT event_type, `+countExpr(r)+` as c
 		FROM analytics.page_events
 		GROUP BY event_type
 		ORDER BY c DESC
@@ -250,7 +289,106 @@ func TypeBreakdownHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	observe("type-breakdown", start, len(typeCounts))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(typeCounts)
 }
 
+
+// GeoHandler serves event counts by country and by city, optionally limited
+// to a time range (from/to), a country (for the city list) and a number of
+// rows per list (limit, default 50).
+func GeoHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := sql.Open("clickhouse", dsn)
+	if err != nil {
+		http.Error(w, "DB error", 500)
+		return
+	}
+	defer db.Close()
+	setSessionLimits(db)
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, _ = strconv.Atoi(l)
+	}
+	if limit <= 0 || limit > 1000 {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	whereClauses := []string{}
+	args := []any{}
+	if from := r.URL.Query().Get("from"); from != "" {
+		whereClauses = append(whereClauses, "ts >= parseDateTimeBestEffort(?)")
+		args = append(args, from)
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		whereClauses = append(whereClauses, "ts <= parseDateTimeBestEffort(?)")
+		args = append(args, to)
+	}
+	where := ""
+	if len(whereClauses) > 0 {
+		where = " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	start := time.Now()
+	rows, err := db.Query(`
+		SELECT country, `+countExpr(r)+` AS c
+		FROM analytics.page_events`+where+`
+		GROUP BY country
+		ORDER BY c DESC
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), 500)
+		return
+	}
+	countries := []map[string]any{}
+	for rows.Next() {
+		var country string
+		var count int
+		if err := rows.Scan(&country, &count); err == nil {
+			countries = append(countries, map[string]any{"country": country, "count": count})
+		}
+	}
+	rows.Close()
+
+	cityClauses := append([]string{"city != ''"}, whereClauses...)
+	cityArgs := append([]any{}, args...)
+	if country := r.URL.Query().Get("country"); country != "" {
+		cityClauses = append(cityClauses, "country = ?")
+		cityArgs = append(cityArgs, country)
+	}
+	rows, err = db.Query(`
+		SELECT country, region, city, `+countExpr(r)+` AS c
+		FROM analytics.page_events
+		WHERE `+strings.Join(cityClauses, " AND ")+`
+		GROUP BY country, region, city
+		ORDER BY c DESC
+		LIMIT ?`, append(cityArgs, limit)...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), 500)
+		return
+	}
+	defer rows.Close()
+	cities := []map[string]any{}
+	for rows.Next() {
+		var country, region, city string
+		var count int
+		if err := rows.Scan(&country, &region, &city, &count); err == nil {
+			cities = append(cities, map[string]any{
+				"country": country,
+				"region":  region,
+				"city":    city,
+				"count":   count,
+			})
+		}
+	}
+
+	observe("geo", start, len(countries)+len(cities))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"countries": countries,
+		"cities":    cities,
+	})
+}
@@ -0,0 +1,137 @@
+// Package auth checks ingest write keys against a key file that is reloaded
+// whenever it changes, so keys can be added or revoked without a restart.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"bigdata-perf/config"
+)
+
+// Key is one entry of the key file. RateLimit and Burst, when set, override
+// the default per-key rate limit.
+type Key struct {
+	Key       string  `json:"key"`
+	Project   string  `json:"project"`
+	Revoked   bool    `json:"revoked,omitempty"`
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+}
+
+// KeyStore holds the keys loaded from a JSON file of the form
+//
+//	[{"key": "wk_live_...", "project": "shop"}, ...]
+//
+// A nil *KeyStore means authentication is disabled.
+type KeyStore struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    map[string]Key
+	modTime time.Time
+}
+
+// KeyStoreFromEnv loads the key file named by API_KEYS_FILE, polled every
+// API_KEYS_RELOAD. Ingest fails closed: without API_KEYS_FILE it is an error
+// unless INGEST_AUTH=disabled, in which case the store is nil and
+// authentication is off.
+func KeyStoreFromEnv() (*KeyStore, error) {
+	path := config.String("API_KEYS_FILE", "")
+	if path == "" {
+		switch mode := config.String("INGEST_AUTH", "required"); mode {
+		case "disabled":
+			log.Println("⚠️  INGEST_AUTH=disabled, ingest is unauthenticated")
+			return nil, nil
+		case "required":
+			return nil, fmt.Errorf("API_KEYS_FILE not set; set INGEST_AUTH=disabled to run ingest without authentication")
+		default:
+			return nil, fmt.Errorf("unknown INGEST_AUTH=%q, expected required or disabled", mode)
+		}
+	}
+	return LoadKeyStore(path, config.Duration("API_KEYS_RELOAD", 10*time.Second))
+}
+
+// LoadKeyStore reads path and polls it for changes every interval.
+func LoadKeyStore(path string, interval time.Duration) (*KeyStore, error) {
+	s := &KeyStore{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	go s.watch(interval)
+	return s, nil
+}
+
+// Lookup returns the key entry for a presented key, unless it is unknown or
+// revoked.
+func (s *KeyStore) Lookup(key string) (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[key]
+	if !ok || k.Revoked {
+		return Key{}, false
+	}
+	return k, true
+}
+
+func (s *KeyStore) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var entries []Key
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	keys := make(map[string]Key, len(entries))
+	for _, k := range entries {
+		if k.Key == "" {
+			continue
+		}
+		keys[k.Key] = k
+	}
+
+	s.mu.Lock()
+	s.keys, s.modTime = keys, info.ModTime()
+	s.mu.Unlock()
+	log.Printf("🔑 Loaded %d API keys from %s", len(keys), s.path)
+	return nil
+}
+
+func (s *KeyStore) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		// On a bad edit keep serving the last good set of keys.
+		if err := s.reload(); err != nil {
+			log.Printf("❌ API key reload failed: %v", err)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the authenticated key.
+func NewContext(ctx context.Context, k Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the key a request was authenticated with, if any.
+func FromContext(ctx context.Context) (Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(Key)
+	return k, ok
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenFromHeader extracts the key from an Authorization header value, either
+// "Bearer <key>" or HTTP Basic with the key as username (as Segment SDKs send).
+func tokenFromHeader(header string) string {
+	scheme, value, ok := strings.Cut(header, " ")
+	if !ok {
+		return ""
+	}
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return strings.TrimSpace(value)
+	case "basic":
+		r := http.Request{Header: http.Header{"Authorization": {header}}}
+		user, _, _ := r.BasicAuth()
+		return user
+	}
+	return ""
+}
+
+// QueryParam is the query parameter BrowserMiddleware reads the write key
+// from.
+const QueryParam = "key"
+
+// Middleware rejects requests without a valid write key with 401, and stores
+// the key in the request context for the handlers.
+func (s *KeyStore) Middleware(next http.Handler) http.Handler {
+	return s.middleware(next, func(r *http.Request) string {
+		return tokenFromHeader(r.Header.Get("Authorization"))
+	})
+}
+
+// BrowserMiddleware is Middleware for endpoints hit by sendBeacon or an
+// <img> tag, which cannot set headers: the key may also come from the
+// QueryParam query parameter. Write keys only allow sending events, so they
+// are safe to embed in a page.
+func (s *KeyStore) BrowserMiddleware(next http.Handler) http.Handler {
+	return s.middleware(next, func(r *http.Request) string {
+		if token := tokenFromHeader(r.Header.Get("Authorization")); token != "" {
+			return token
+		}
+		return r.URL.Query().Get(QueryParam)
+	})
+}
+
+func (s *KeyStore) middleware(next http.Handler, token func(*http.Request) string) http.Handler {
+	if s == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k, ok := s.Lookup(token(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ingest"`)
+			http.Error(w, "invalid or missing API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), k)))
+	})
+}
+
+// authenticate checks the "authorization" metadata of a call and returns ctx
+// carrying its key, or UNAUTHENTICATED when the key is missing or invalid.
+func (s *KeyStore) authenticate(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			header = v[0]
+		}
+	}
+	k, ok := s.Lookup(tokenFromHeader(header))
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing API key")
+	}
+	return NewContext(ctx, k), nil
+}
+
+// UnaryInterceptor checks the "authorization" metadata of every call and
+// fails it with UNAUTHENTICATED when the key is missing or invalid.
+func (s *KeyStore) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if s == nil {
+			return handler(ctx, req)
+		}
+		ctx, err := s.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// serverStream is a grpc.ServerStream with a replaced context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// StreamInterceptor is UnaryInterceptor for streaming calls, checked when
+// the stream opens.
+func (s *KeyStore) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if s == nil {
+			return handler(srv, ss)
+		}
+		ctx, err := s.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ss, ctx})
+	}
+}
@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"bigdata-perf/config"
+)
+
+// DefaultExchange is the topic exchange events are published to unless
+// EVENTS_EXCHANGE names another.
+const DefaultExchange = "events"
+
+// Routing key prefixes. Events are published as event.<event_type>, and
+// quarantined ones as quarantine.<event_type>.
+const (
+	EventKeyPrefix      = "event."
+	QuarantineKeyPrefix = "quarantine."
+)
+
+// Binding routes messages whose routing key matches Pattern (a topic pattern
+// such as "event.#" or "event.purchase") to Queue.
+type Binding struct {
+	Queue   string
+	Pattern string
+}
+
+func (b Binding) String() string {
+	return b.Queue + ":" + b.Pattern
+}
+
+// QuarantineBinding sends every quarantined event to QuarantineQueue.
+var QuarantineBinding = Binding{Queue: QuarantineQueue, Pattern: QuarantineKeyPrefix + "#"}
+
+// ExchangeFromEnv returns the exchange named by EVENTS_EXCHANGE.
+func ExchangeFromEnv() string {
+	return config.String("EVENTS_EXCHANGE", DefaultExchange)
+}
+
+// BindingsFromEnv parses EVENT_BINDINGS, a comma-separated list of
+// queue:pattern pairs. The default binds every event to EventsQueue.
+func BindingsFromEnv() []Binding {
+	var bindings []Binding
+	for _, entry := range config.List("EVENT_BINDINGS", []string{EventsQueue + ":" + EventKeyPrefix + "#"}) {
+		queue, pattern, ok := strings.Cut(entry, ":")
+		if !ok || queue == "" || pattern == "" {
+			log.Printf("⚠️  Ignoring invalid EVENT_BINDINGS entry %q, expected queue:pattern", entry)
+			continue
+		}
+		bindings = append(bindings, Binding{Queue: queue, Pattern: pattern})
+	}
+	return bindings
+}
+
+// RoutingKey returns the routing key of an event of the given type. Dots
+// separate words in topic routing, so they are replaced to keep the type a
+// single word.
+func RoutingKey(eventType string) string {
+	return EventKeyPrefix + strings.ReplaceAll(eventType, ".", "_")
+}
+
+// QuarantineKey returns the routing key of a quarantined event.
+func QuarantineKey(eventType string) string {
+	return QuarantineKeyPrefix + strings.ReplaceAll(eventType, ".", "_")
+}
+
+// DeclareExchange declares the durable topic exchange, then each binding's
+// queue and its binding to the exchange.
+func DeclareExchange(ch *amqp091.Channel, exchange string, bindings ...Binding) error {
+	if err := ch.ExchangeDeclare(exchange, amqp091.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare exchange %s: %w", exchange, err)
+	}
+	for _, b := range bindings {
+		if err := DeclareQueue(ch, b.Queue); err != nil {
+			return fmt.Errorf("declare queue %s: %w", b.Queue, err)
+		}
+		if err := ch.QueueBind(b.Queue, b.Pattern, exchange, false, nil); err != nil {
+			return fmt.Errorf("bind %s: %w", b, err)
+		}
+	}
+	return nil
+}
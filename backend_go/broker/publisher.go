@@ -0,0 +1,225 @@
+// Package broker wraps the RabbitMQ plumbing shared by the ingest services.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"bigdata-perf/metrics"
+)
+
+var (
+	// ErrNacked is returned when the broker negatively acknowledges a publish.
+	ErrNacked = errors.New("broker nacked publish")
+	// ErrConfirmTimeout is returned when no confirm arrives in time.
+	ErrConfirmTimeout = errors.New("timed out waiting for broker confirm")
+	// ErrUnroutable is returned when no binding matched the routing key, so
+	// the broker returned the message instead of queueing it. It is a
+	// configuration problem rather than an outage, so it is not retryable.
+	ErrUnroutable = errors.New("no queue bound for routing key")
+)
+
+// Queues used by the ingest pipeline.
+const (
+	// EventsQueue is bound to every event by default and is what
+	// cmd/consumer reads unless configured otherwise.
+	EventsQueue = "events"
+	// QuarantineQueue holds events set aside for inspection, e.g. with a
+	// client timestamp outside the allowed skew. Nothing consumes it.
+	QuarantineQueue = "events_quarantine"
+)
+
+// Publisher publishes to a topic exchange on a session channel in confirm
+// mode.
+// Confirms are tracked per message by the client library, so any number of
+// publishes can be in flight while callers wait on their own confirmation.
+// Messages are published as mandatory, so one that no binding routes is
+// returned by the broker and fails with ErrUnroutable rather than being
+// dropped.
+type Publisher struct {
+	session  *Session
+	exchange string
+	timeout  time.Duration
+
+	// pending counts publishes the broker has not confirmed yet, whether or
+	// not anyone is still waiting on them.
+	pending sync.WaitGroup
+
+	// returns holds the returnWatcher of each open channel.
+	returns sync.Map
+	// nextID numbers messages so returns can be matched to them.
+	nextID atomic.Uint64
+}
+
+// Confirmation is the outcome of a sent message, known once the broker
+// confirms it.
+type Confirmation struct {
+	done chan struct{}
+	err  error
+}
+
+// NewPublisher opens a session to url whose channels declare exchange with
+// bindings and run in confirm mode. Declaring the bindings up front means
+// events are queued even before any consumer has started. timeout bounds how
+// long Await waits for the broker to ack a message.
+func NewPublisher(url, exchange string, timeout time.Duration, bindings ...Binding) *Publisher {
+	p := &Publisher{exchange: exchange, timeout: timeout}
+	setup := func(ch *amqp091.Channel) error {
+		if err := DeclareExchange(ch, exchange, bindings...); err != nil {
+			return err
+		}
+		if err := ch.Confirm(false); err != nil {
+			return fmt.Errorf("enable confirm mode: %w", err)
+		}
+		w := watchReturns(ch)
+		p.returns.Store(ch, w)
+		go func() {
+			<-w.done
+			p.returns.Delete(ch)
+		}()
+		return nil
+	}
+	p.session = NewSession(url, setup)
+	return p
+}
+
+// Close closes the underlying session. Call Drain first to let in-flight
+// publishes be confirmed.
+func (p *Publisher) Close() {
+	p.session.Close()
+}
+
+// Ready reports whether the publisher has an open channel to publish on.
+func (p *Publisher) Ready(ctx context.Context) error {
+	return p.session.Ready(ctx)
+}
+
+// Drain waits until every sent message has been confirmed or nacked, or ctx
+// expires.
+func (p *Publisher) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send publishes body to the exchange with routing key without waiting for
+// the broker. The returned confirmation must be passed to Await.
+func (p *Publisher) Send(ctx context.Context, key string, body []byte) (*Confirmation, error) {
+	ch, err := p.session.Channel()
+	if err != nil {
+		metrics.PublishFailures.WithLabelValues(p.exchange, "unavailable").Inc()
+		return nil, err
+	}
+	w, ok := p.returns.Load(ch)
+	if !ok {
+		// The channel closed since Channel returned it.
+		metrics.PublishFailures.WithLabelValues(p.exchange, "unavailable").Inc()
+		return nil, ErrUnavailable
+	}
+	id := strconv.FormatUint(p.nextID.Add(1), 10)
+	start := time.Now()
+	dc, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		p.exchange,
+		key,
+		true,
+		false,
+		amqp091.Publishing{
+			DeliveryMode: amqp091.Persistent,
+			ContentType:  "application/octet-stream",
+			MessageId:    id,
+			Body:         body,
+		},
+	)
+	if errors.Is(err, amqp091.ErrClosed) {
+		metrics.PublishFailures.WithLabelValues(p.exchange, "unavailable").Inc()
+		return nil, ErrUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Confirmation{done: make(chan struct{})}
+	p.pending.Add(1)
+	go func() {
+		// Done is closed on ack, nack, or when the channel shuts down. A
+		// confirm slower than the Await timeout is counted once as a timeout
+		// and still observed if it arrives later.
+		timer := time.NewTimer(p.timeout)
+		select {
+		case <-dc.Done():
+		case <-timer.C:
+			metrics.PublishFailures.WithLabelValues(p.exchange, "timeout").Inc()
+			<-dc.Done()
+		}
+		timer.Stop()
+		switch {
+		case !dc.Acked():
+			c.err = ErrNacked
+			metrics.PublishFailures.WithLabelValues(p.exchange, "nack").Inc()
+		case w.(*returnWatcher).returned(id):
+			// An unroutable message is acked too, right after its return.
+			c.err = ErrUnroutable
+			metrics.PublishFailures.WithLabelValues(p.exchange, "unroutable").Inc()
+		default:
+			metrics.PublishDuration.WithLabelValues(p.exchange).Observe(time.Since(start).Seconds())
+		}
+		close(c.done)
+		p.pending.Done()
+	}()
+	return c, nil
+}
+
+// Await blocks until c is confirmed, returning ErrNacked, ErrUnroutable or
+// ErrConfirmTimeout when the broker did not take the message.
+func (p *Publisher) Await(ctx context.Context, c *Confirmation) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ErrConfirmTimeout
+	}
+}
+
+// Publish sends body with routing key and waits for its confirm.
+func (p *Publisher) Publish(ctx context.Context, key string, body []byte) error {
+	dc, err := p.Send(ctx, key, body)
+	if err != nil {
+		return err
+	}
+	return p.Await(ctx, dc)
+}
+
+// IsRetryable reports whether err means the broker is unreachable or did not
+// confirm the message, which callers surface as a retryable "unavailable"
+// error.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrNacked) || errors.Is(err, ErrConfirmTimeout)
+}
+
+// PermanentReason returns "unroutable" for ErrUnroutable, which no retry of
+// the same message can fix, and "" for any other error.
+func PermanentReason(err error) string {
+	if errors.Is(err, ErrUnroutable) {
+		return "unroutable"
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"log"
+	"sync"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// returnWatcher records the messages the broker returned on one channel as
+// unroutable, by message id.
+//
+// For a mandatory message that no queue takes, RabbitMQ sends basic.return
+// before basic.ack, and the client library hands both over from a single
+// reader goroutine. The return channel is unbuffered, so the return has been
+// received by the time the ack is seen; returned then syncs with the watcher
+// goroutine to be sure it has also been recorded.
+type returnWatcher struct {
+	barrier chan struct{}
+	done    chan struct{}
+
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// watchReturns starts recording the returns of ch until it closes.
+func watchReturns(ch *amqp091.Channel) *returnWatcher {
+	w := &returnWatcher{
+		barrier: make(chan struct{}),
+		done:    make(chan struct{}),
+		ids:     map[string]bool{},
+	}
+	returns := ch.NotifyReturn(make(chan amqp091.Return))
+	go func() {
+		defer close(w.done)
+		for {
+			select {
+			case ret, ok := <-returns:
+				if !ok {
+					return
+				}
+				log.Printf("⚠️  Broker returned message %s: %s (routing key %s)", ret.MessageId, ret.ReplyText, ret.RoutingKey)
+				w.mu.Lock()
+				w.ids[ret.MessageId] = true
+				w.mu.Unlock()
+			case <-w.barrier:
+			}
+		}
+	}()
+	return w
+}
+
+// returned reports whether the acked message id was returned, forgetting it.
+func (w *returnWatcher) returned(id string) bool {
+	select {
+	case w.barrier <- struct{}{}:
+	case <-w.done:
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ok := w.ids[id]
+	delete(w.ids, id)
+	return ok
+}
@@ -0,0 +1,147 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// ErrUnavailable is returned while the session is (re)connecting to RabbitMQ.
+var ErrUnavailable = errors.New("rabbitmq connection unavailable")
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// SetupFunc prepares a freshly opened channel: declaring queues, enabling
+// confirms, registering consumers. It runs again after every reconnect.
+type SetupFunc func(ch *amqp091.Channel) error
+
+// Session keeps one AMQP connection and channel open, redialling with
+// exponential backoff whenever the broker closes either of them.
+type Session struct {
+	url   string
+	setup SetupFunc
+
+	mu   sync.RWMutex
+	conn *amqp091.Connection
+	ch   *amqp091.Channel
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewSession starts connecting to url in the background. Callers that need a
+// channel before the first connection succeeds get ErrUnavailable.
+func NewSession(url string, setup SetupFunc) *Session {
+	s := &Session{url: url, setup: setup, done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+// Channel returns the current channel, or ErrUnavailable while reconnecting.
+func (s *Session) Channel() (*amqp091.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ch == nil || s.ch.IsClosed() {
+		return nil, ErrUnavailable
+	}
+	return s.ch, nil
+}
+
+// Ready reports whether a channel is currently open. It has the signature of
+// a readiness check.
+func (s *Session) Ready(ctx context.Context) error {
+	_, err := s.Channel()
+	return err
+}
+
+// Close stops reconnecting and closes the current connection.
+func (s *Session) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.conn, s.ch = nil, nil
+	})
+}
+
+func (s *Session) run() {
+	backoff := minBackoff
+	for {
+		conn, ch, err := s.connect()
+		if err != nil {
+			log.Printf("❌ RabbitMQ connect failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+
+		connClosed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp091.Error, 1))
+
+		s.mu.Lock()
+		select {
+		case <-s.done:
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conn, s.ch = conn, ch
+		s.mu.Unlock()
+		log.Println("🐇 RabbitMQ session ready")
+
+		select {
+		case <-s.done:
+			return
+		case err := <-connClosed:
+			log.Printf("⚠️  RabbitMQ connection closed: %v", err)
+		case err := <-chClosed:
+			log.Printf("⚠️  RabbitMQ channel closed: %v", err)
+		}
+
+		s.mu.Lock()
+		s.conn, s.ch = nil, nil
+		s.mu.Unlock()
+		conn.Close()
+	}
+}
+
+func (s *Session) connect() (*amqp091.Connection, *amqp091.Channel, error) {
+	conn, err := amqp091.Dial(s.url)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if s.setup != nil {
+		if err := s.setup(ch); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, ch, nil
+}
+
+// DeclareQueue declares the durable queue the ingest pipeline uses.
+func DeclareQueue(ch *amqp091.Channel, queue string) error {
+	_, err := ch.QueueDeclare(queue, true, false, false, false, nil)
+	return err
+}
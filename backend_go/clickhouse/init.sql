@@ -1,5 +1,11 @@
 CREATE DATABASE IF NOT EXISTS analytics;
 
+-- ReplacingMergeTree collapses rows sharing the sorting key during merges,
+-- so retried events (same project, same day, same id) end up stored once.
+-- Ids are chosen by clients, so the project is part of the key: two
+-- projects sending the same id are kept apart. Tables created with the old
+-- MergeTree engine or the old (toDate(ts), id) key must be recreated to pick
+-- this up, since ClickHouse cannot change the leading sorting columns.
 CREATE TABLE IF NOT EXISTS analytics.page_events (
   id String,
   user_id String,
@@ -7,7 +13,34 @@ CREATE TABLE IF NOT EXISTS analytics.page_events (
   url String,
   referrer String,
   ts DateTime,
-  meta String
-) ENGINE = MergeTree()
-ORDER BY ts;
+  meta String,
+  received_at DateTime,
+  project LowCardinality(String),
+  client_ip String,
+  user_agent String,
+  browser LowCardinality(String),
+  browser_version String,
+  os LowCardinality(String),
+  os_version String,
+  device_type LowCardinality(String),
+  country LowCardinality(String),
+  region LowCardinality(String),
+  city String,
+  sample_rate Float32 DEFAULT 1
+) ENGINE = ReplacingMergeTree(received_at)
+ORDER BY (project, toDate(ts), id);
 
+-- Columns added after the initial schema; keeps existing tables in step.
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS received_at DateTime DEFAULT ts;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS project LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS client_ip String;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS user_agent String;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS browser LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS browser_version String;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS os LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS os_version String;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS device_type LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS country LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS region LowCardinality(String);
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS city String;
+ALTER TABLE analytics.page_events ADD COLUMN IF NOT EXISTS sample_rate Float32 DEFAULT 1;
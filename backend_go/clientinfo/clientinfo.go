@@ -0,0 +1,131 @@
+// Package clientinfo captures who sent a request: the client IP, resolved
+// through X-Forwarded-For only when the hops are trusted proxies, and the
+// User-Agent.
+package clientinfo
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+
+	"bigdata-perf/config"
+)
+
+// Info describes the client of one request.
+type Info struct {
+	IP        netip.Addr
+	UserAgent string
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying info.
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the client info stored by Middleware or
+// UnaryInterceptor.
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// Resolver finds the client IP of a request. X-Forwarded-For is only
+// followed through hops that are trusted proxies, so a client cannot spoof
+// its address by sending the header itself.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// ResolverFromEnv trusts the proxies listed in TRUSTED_PROXIES, a
+// comma-separated list of IPs and CIDRs. Without it X-Forwarded-For is
+// ignored.
+func ResolverFromEnv() *Resolver {
+	r := &Resolver{}
+	for _, entry := range config.List("TRUSTED_PROXIES", nil) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				log.Printf("⚠️  Ignoring invalid TRUSTED_PROXIES entry %q", entry)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r
+}
+
+func (r *Resolver) isTrusted(ip netip.Addr) bool {
+	for _, p := range r.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client address for a connection from remoteAddr
+// carrying the given X-Forwarded-For values. Starting from the peer, it walks
+// the forwarded hops right to left while the current hop is a trusted proxy,
+// and returns the first untrusted one. An unparsable hop stops the walk.
+func (r *Resolver) ClientIP(remoteAddr string, forwarded []string) netip.Addr {
+	ip := ParseHost(remoteAddr)
+	if !ip.IsValid() || !r.isTrusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, v := range forwarded {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ip
+		}
+		ip = hop.Unmap()
+		if !r.isTrusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// ParseHost parses the IP of a host:port (or bare host) address, returning
+// the zero Addr when it is not an IP.
+func ParseHost(addr string) netip.Addr {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
+
+// Truncate zeroes the host part of ip, keeping the first v4Bits of an IPv4
+// address or v6Bits of an IPv6 one, e.g. 24 and 48 to anonymize. Bit counts
+// at or above the address length leave ip unchanged.
+func Truncate(ip netip.Addr, v4Bits, v6Bits int) netip.Addr {
+	if !ip.IsValid() {
+		return ip
+	}
+	bits := v6Bits
+	if ip.Is4() {
+		bits = v4Bits
+	}
+	if bits >= ip.BitLen() {
+		return ip
+	}
+	prefix, err := ip.Prefix(max(0, bits))
+	if err != nil {
+		return ip
+	}
+	return prefix.Addr()
+}
@@ -0,0 +1,88 @@
+package clientinfo
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1, ::1, not-a-proxy")
+	r := ResolverFromEnv()
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"untrusted peer ignores header", "203.0.113.7:51234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted single ip", "192.168.1.1:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted ipv6 loopback", "[::1]:443", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"spoofed leftmost hop", "10.1.2.3:443", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.1.2.3:443", []string{"198.51.100.1, 10.0.0.5", "10.9.9.9"}, "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:443", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"unparsable hop stops walk", "10.1.2.3:443", []string{"198.51.100.1, garbage"}, "10.1.2.3"},
+		{"mapped ipv4 hop", "10.1.2.3:443", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+		{"no header behind proxy", "10.1.2.3:443", nil, "10.1.2.3"},
+		{"bare host", "203.0.113.7", nil, "203.0.113.7"},
+		{"invalid remote", "@", nil, "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ClientIP(tt.remote, tt.forwarded).String(); got != tt.want {
+				t.Errorf("ClientIP(%q, %q) = %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.0.2.1:80", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"[2001:db8::1]:80", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[::ffff:192.0.2.1]:80", "192.0.2.1"},
+		{"example.com:80", "invalid IP"},
+		{"", "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := ParseHost(tt.addr).String(); got != tt.want {
+				t.Errorf("ParseHost(%q) = %s, want %s", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		ip     string
+		v4, v6 int
+		want   string
+	}{
+		{"192.0.2.123", 24, 48, "192.0.2.0"},
+		{"192.0.2.123", 32, 48, "192.0.2.123"},
+		{"192.0.2.123", 64, 48, "192.0.2.123"},
+		{"192.0.2.123", 0, 48, "0.0.0.0"},
+		{"192.0.2.123", -1, 48, "0.0.0.0"},
+		{"2001:db8:abcd:12::1", 24, 48, "2001:db8:abcd::"},
+		{"2001:db8:abcd:12::1", 24, 128, "2001:db8:abcd:12::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got := Truncate(netip.MustParseAddr(tt.ip), tt.v4, tt.v6)
+			if got.String() != tt.want {
+				t.Errorf("Truncate(%s, %d, %d) = %s, want %s", tt.ip, tt.v4, tt.v6, got, tt.want)
+			}
+		})
+	}
+	if got := Truncate(netip.Addr{}, 24, 48); got.IsValid() {
+		t.Errorf("Truncate(zero) = %s, want the zero Addr", got)
+	}
+}
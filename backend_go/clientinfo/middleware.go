@@ -0,0 +1,60 @@
+package clientinfo
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Middleware stores the client info of each request in its context.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		info := Info{
+			IP:        r.ClientIP(req.RemoteAddr, req.Header.Values("X-Forwarded-For")),
+			UserAgent: req.UserAgent(),
+		}
+		next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), info)))
+	})
+}
+
+// fromIncoming returns the client info of a gRPC call, read from the peer
+// address and the "x-forwarded-for" and "user-agent" metadata.
+func (r *Resolver) fromIncoming(ctx context.Context) Info {
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := Info{IP: r.ClientIP(remote, md.Get("x-forwarded-for"))}
+	if ua := md.Get("user-agent"); len(ua) > 0 {
+		client.UserAgent = ua[0]
+	}
+	return client
+}
+
+// UnaryInterceptor stores the client info of each call in its context.
+func (r *Resolver) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(NewContext(ctx, r.fromIncoming(ctx)), req)
+	}
+}
+
+// serverStream is a grpc.ServerStream with a replaced context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// StreamInterceptor stores the client info of each streaming call in its
+// context.
+func (r *Resolver) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		return handler(srv, &serverStream{ss, NewContext(ctx, r.fromIncoming(ctx))})
+	}
+}
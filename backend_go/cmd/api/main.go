@@ -12,6 +12,8 @@ import (
 	"github.com/joho/godotenv"
 
 	"bigdata-perf/api"
+	"bigdata-perf/health"
+	"bigdata-perf/metrics"
 )
 
 func main() {
@@ -45,6 +47,13 @@ func main() {
 	r.Get("/metrics/events", api.EventsHandler)
 	r.Get("/metrics/time-series", api.TimeSeriesHandler)
 	r.Get("/metrics/type-breakdown", api.TypeBreakdownHandler)
+	r.Get("/metrics/geo", api.GeoHandler)
+
+	checker := health.New()
+	checker.Add("clickhouse", api.PingClickHouse)
+	r.Get("/healthz", checker.Liveness)
+	r.Get("/readyz", checker.Readiness)
+	r.Handle("/metrics", metrics.Handler())
 
 	log.Printf("🚀 API running on :%s", port)
 	http.ListenAndServe(":"+port, r)
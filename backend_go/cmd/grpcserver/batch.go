@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"bigdata-perf/broker"
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+	"bigdata-perf/ratelimit"
+)
+
+// maxBatchEvents caps how many events a single PublishBatch call may carry,
+// as for HTTP batches.
+const maxBatchEvents = 1000
+
+// maxSummaryRejections caps the rejections listed in a PublishSummary.
+const maxSummaryRejections = 1000
+
+// rejection returns the result of an event the pipeline refused with err.
+func rejection(index int64, id string, err error) *ingestpb.EventResult {
+	res := &ingestpb.EventResult{Index: index, Id: id, Status: "rejected", Reason: err.Error()}
+	for _, v := range ingest.Violations(err) {
+		res.Violations = append(res.Violations, &ingestpb.FieldViolation{Field: v.Field, Description: v.Description})
+	}
+	return res
+}
+
+// PublishBatch publishes every event before collecting the confirms, so the
+// batch costs one broker round trip, and reports a result per event. As for
+// PublishEvent, the event id is the idempotency key: an event whose id was
+// already accepted is not published again and reports the original result.
+// Like /events/batch, the call only fails, with UNAVAILABLE, when nothing was
+// accepted because the broker was unavailable.
+func (s *server) PublishBatch(ctx context.Context, batch *ingestpb.EventBatch) (*ingestpb.BatchResponse, error) {
+	if len(batch.Events) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty batch")
+	}
+	if len(batch.Events) > maxBatchEvents {
+		return nil, status.Errorf(codes.InvalidArgument, "batch too large: %d events (max %d)", len(batch.Events), maxBatchEvents)
+	}
+	// The call paid for one event on the way in.
+	if err := ratelimit.ChargeGRPC(ctx, len(batch.Events)-1); err != nil {
+		return nil, err
+	}
+
+	resp := &ingestpb.BatchResponse{Results: make([]*ingestpb.EventResult, len(batch.Events))}
+	receipts := make([]*ingest.Receipt, len(batch.Events))
+	unavailable := 0
+	for i, req := range batch.Events {
+		receipt, _, err := s.pipeline.SendOnce(ctx, req.Id, req)
+		if err != nil {
+			log.Printf("❌ Failed to publish message %d: %v", i, err)
+			if broker.IsRetryable(err) {
+				unavailable++
+			}
+			resp.Results[i] = rejection(int64(i), req.Id, err)
+			continue
+		}
+		receipts[i] = receipt
+	}
+	for i, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		if err := s.pipeline.Await(ctx, receipt); err != nil {
+			log.Printf("❌ Message %d not confirmed: %v", i, err)
+			unavailable++
+			resp.Results[i] = rejection(int64(i), receipt.ID, err)
+			continue
+		}
+		resp.Results[i] = &ingestpb.EventResult{Index: int64(i), Id: receipt.ID, Status: receipt.Status, Replayed: receipt.Replayed()}
+	}
+
+	for _, res := range resp.Results {
+		if res.Status == "rejected" {
+			resp.Rejected++
+		} else {
+			resp.Accepted++
+		}
+	}
+	log.Printf("✅ Batch processed: %d accepted, %d rejected", resp.Accepted, resp.Rejected)
+	if resp.Accepted == 0 && unavailable > 0 {
+		return nil, status.Error(codes.Unavailable, "broker unavailable, retry later")
+	}
+	return resp, nil
+}
+
+// streamSummary collects the outcomes of a PublishEvents stream. The receive
+// loop and the confirm loop both report into it.
+type streamSummary struct {
+	mu      sync.Mutex
+	summary ingestpb.PublishSummary
+	// failed is closed on the first broker outage, which ends the stream.
+	failed  chan struct{}
+	failErr error
+}
+
+func (s *streamSummary) accept(replayed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Accepted++
+	if replayed {
+		s.summary.Replayed++
+	}
+}
+
+// reject records an event the pipeline refused with err. A broker outage
+// fails the stream instead, since every later event would fail the same way.
+func (s *streamSummary) reject(index int64, id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if broker.IsRetryable(err) {
+		if s.failErr == nil {
+			s.failErr = err
+			close(s.failed)
+		}
+		return
+	}
+	s.summary.Rejected++
+	if len(s.summary.Rejections) < maxSummaryRejections {
+		s.summary.Rejections = append(s.summary.Rejections, rejection(index, id, err))
+	}
+}
+
+// PublishEvents publishes a client stream of events. Each event is sent as it
+// arrives and its confirm awaited by a second goroutine; at most
+// streamWindow events wait for their confirm at a time, after which the
+// stream stops being read until the broker catches up, so gRPC flow control
+// slows the client to what the broker takes. Refused events are listed in
+// the summary. Event ids are idempotency keys, as for PublishBatch, so a
+// client retrying a stream with the same ids does not publish the events
+// already accepted again. A broker outage ends the stream with UNAVAILABLE
+// once the events in flight are settled (and spooled when a spool is
+// configured).
+func (s *server) PublishEvents(stream ingestpb.EventService_PublishEventsServer) error {
+	ctx := stream.Context()
+	sum := &streamSummary{failed: make(chan struct{})}
+
+	type pending struct {
+		index   int64
+		receipt *ingest.Receipt
+	}
+	inflight := make(chan pending, s.streamWindow)
+	confirmed := make(chan struct{})
+	go func() {
+		defer close(confirmed)
+		for p := range inflight {
+			if err := s.pipeline.Await(ctx, p.receipt); err != nil {
+				sum.reject(p.index, p.receipt.ID, err)
+				continue
+			}
+			sum.accept(p.receipt.Replayed())
+		}
+	}()
+
+	var recvErr error
+receive:
+	for index := int64(0); ; index++ {
+		select {
+		case <-sum.failed:
+			break receive
+		default:
+		}
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			recvErr = err
+			break
+		}
+		receipt, _, err := s.pipeline.SendOnce(ctx, req.Id, req)
+		if err != nil {
+			sum.reject(index, req.Id, err)
+			continue
+		}
+		select {
+		case inflight <- pending{index, receipt}:
+		case <-sum.failed:
+			// Settle the event sent last too, so it is spooled or counted.
+			inflight <- pending{index, receipt}
+			break receive
+		}
+	}
+	close(inflight)
+	<-confirmed
+
+	sum.mu.Lock()
+	defer sum.mu.Unlock()
+	switch {
+	case recvErr != nil:
+		log.Printf("❌ Event stream broken after %d accepted events: %v", sum.summary.Accepted, recvErr)
+		return recvErr
+	case sum.failErr != nil:
+		log.Printf("❌ Event stream failed after %d accepted events: %v", sum.summary.Accepted, sum.failErr)
+		return status.Error(codes.Unavailable, fmt.Sprintf("broker unavailable after %d accepted events, retry later: %v", sum.summary.Accepted, sum.failErr))
+	}
+	log.Printf("✅ Event stream processed: %d accepted, %d rejected", sum.summary.Accepted, sum.summary.Rejected)
+	return stream.SendAndClose(&sum.summary)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"bigdata-perf/broker"
+	"bigdata-perf/ingest"
+	"bigdata-perf/ratelimit"
+)
+
+// maxBatchEvents caps how many events a single /events/batch call may carry.
+const maxBatchEvents = 1000
+
+type batchResult struct {
+	Index      int                     `json:"index"`
+	ID         string                  `json:"id,omitempty"`
+	Status     string                  `json:"status"`
+	Reason     string                  `json:"reason,omitempty"`
+	Violations []ingest.FieldViolation `json:"violations,omitempty"`
+	Replayed   bool                    `json:"replayed,omitempty"`
+}
+
+type batchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []batchResult `json:"results"`
+}
+
+// splitBatch returns the raw JSON items of a batch body. A body starting with
+// '[' is treated as a JSON array, anything else as NDJSON (one event per line).
+func splitBatch(body []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	items := []json.RawMessage{}
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(append([]byte(nil), line...)))
+	}
+	return items, scanner.Err()
+}
+
+func batchHandler(pipeline *ingest.Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+
+		items, err := decodeBatch(r, body)
+		if err != nil {
+			decodeError(w, err)
+			return
+		}
+		if len(items) == 0 {
+			http.Error(w, "empty batch", 400)
+			return
+		}
+		if len(items) > maxBatchEvents {
+			http.Error(w, fmt.Sprintf("batch too large: %d events (max %d)", len(items), maxBatchEvents), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// The request paid for one event on the way in.
+		if !ratelimit.ChargeHTTP(w, r, len(items)-1) {
+			return
+		}
+		resp, unavailable := publishBatch(r.Context(), pipeline, items)
+		writeBatchResponse(w, resp, unavailable)
+	}
+}
+
+// publishBatch publishes the decoded items of a batch and reports each
+// outcome, along with how many items failed because the broker was
+// unavailable. Everything is sent first and the confirms collected
+// afterwards, so the batch costs one broker round trip rather than one per
+// event. Items with a key already published within the idempotency window
+// are not published again and report the original result, with replayed
+// set.
+func publishBatch(ctx context.Context, pipeline *ingest.Pipeline, items []decodedEvent) (batchResponse, int) {
+	results := make([]batchResult, len(items))
+	receipts := make([]*ingest.Receipt, len(items))
+	unavailable := 0
+	for i, item := range items {
+		if item.err != nil {
+			results[i] = batchResult{Index: i, Status: "rejected", Reason: item.err.Error(), Violations: ingest.Violations(item.err)}
+			continue
+		}
+
+		receipt, _, err := pipeline.SendOnce(ctx, item.key, item.req)
+		if err != nil {
+			log.Printf("❌ Failed to publish message %d: %v", i, err)
+			if broker.IsRetryable(err) {
+				unavailable++
+			}
+			results[i] = batchResult{Index: i, ID: item.req.Id, Status: "rejected", Reason: err.Error(), Violations: ingest.Violations(err)}
+			continue
+		}
+		receipts[i] = receipt
+	}
+
+	for i, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		if err := pipeline.Await(ctx, receipt); err != nil {
+			log.Printf("❌ Message %d not confirmed: %v", i, err)
+			unavailable++
+			results[i] = batchResult{Index: i, ID: receipt.ID, Status: "rejected", Reason: err.Error()}
+			continue
+		}
+		status := "accepted"
+		if receipt.Status != ingest.StatusQueued {
+			status = receipt.Status
+		}
+		results[i] = batchResult{Index: i, ID: receipt.ID, Status: status, Replayed: receipt.Replayed()}
+	}
+
+	resp := batchResponse{Results: results}
+	for _, res := range results {
+		if res.Status != "rejected" {
+			resp.Accepted++
+		} else {
+			resp.Rejected++
+		}
+	}
+	return resp, unavailable
+}
+
+// writeBatchResponse writes the outcome of a batch. Only the whole call fails,
+// with 503, when nothing was accepted because the broker was unavailable;
+// other failures are reported per item.
+func writeBatchResponse(w http.ResponseWriter, resp batchResponse, unavailable int) {
+	log.Printf("✅ Batch processed: %d accepted, %d rejected", resp.Accepted, resp.Rejected)
+	w.Header().Set("Content-Type", "application/json")
+	status := http.StatusAccepted
+	if resp.Accepted == 0 && unavailable > 0 {
+		w.Header().Set("Retry-After", "1")
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// maxBodyBytes caps the request body as sent on the wire.
+	maxBodyBytes int64 = 1 << 20
+	// maxDecodedBytes caps the body after decompression, so a small
+	// compressed payload cannot expand without bound.
+	maxDecodedBytes int64 = 10 << 20
+)
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+)
+
+// readBody returns the request body, decompressed according to its
+// Content-Encoding (gzip, deflate or zstd).
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	defer body.Close()
+
+	decoded, closeFn, err := decompress(body, r.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	// Read one byte past the limit to tell "exactly at" from "over".
+	data, err := io.ReadAll(io.LimitReader(decoded, maxDecodedBytes+1))
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		return nil, errBodyTooLarge
+	case err != nil:
+		return nil, fmt.Errorf("read body: %w", err)
+	case int64(len(data)) > maxDecodedBytes:
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+func decompress(body io.Reader, encoding string) (io.Reader, func(), error) {
+	noop := func() {}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, noop, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip: %w", err)
+		}
+		return zr, func() { zr.Close() }, nil
+	case "deflate":
+		// HTTP "deflate" is zlib-wrapped, but some clients send raw deflate.
+		br := bufio.NewReader(body)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, nil, fmt.Errorf("deflate: %w", err)
+			}
+			return zr, func() { zr.Close() }, nil
+		}
+		fr := flate.NewReader(br)
+		return fr, func() { fr.Close() }, nil
+	case "zstd":
+		zr, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxDecodedBytes)),
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd: %w", err)
+		}
+		return zr, zr.Close, nil
+	}
+	return nil, nil, errUnsupportedEncoding
+}
+
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// bodyError writes the HTTP error for a failed readBody.
+func bodyError(w http.ResponseWriter, err error) {
+	log.Printf("❌ Error reading body: %v", err)
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUnsupportedEncoding):
+		w.Header().Set("Accept-Encoding", "gzip, deflate, zstd")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	default:
+		http.Error(w, "bad request", 400)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"bigdata-perf/auth"
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+)
+
+// transparentGIF is a 1x1 transparent GIF89a.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// cacheBusters are pixel query parameters that only defeat caches and are
+// not part of the event.
+var cacheBusters = []string{"cb", "_", "rnd"}
+
+// browserHeaders adds the CORS and no-cache headers of the browser endpoints
+// and answers CORS preflights itself, before authentication. origins lists
+// the allowed Origin values; "*" allows any. The origin is echoed rather than
+// answered with "*" because sendBeacon sends credentials.
+func browserHeaders(origins []string, next http.Handler) http.Handler {
+	allowAny := slices.Contains(origins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+		h.Set("Pragma", "no-cache")
+		h.Set("Expires", "0")
+		h.Add("Vary", "Origin")
+
+		if origin := r.Header.Get("Origin"); origin != "" && (allowAny || slices.Contains(origins, origin)) {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Content-Encoding")
+			h.Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// beaconHandler accepts navigator.sendBeacon payloads: the same event as
+// /events, usually sent as text/plain so the browser skips the CORS
+// preflight. The event id, when set, doubles as the idempotency key since a
+// beacon cannot carry headers.
+func beaconHandler(pipeline *ingest.Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+
+		var req *ingestpb.EventRequest
+		if mediaType(r) == "text/plain" {
+			req = &ingestpb.EventRequest{}
+			err = unmarshalJSON(body, req)
+		} else {
+			req, err = decodeEvent(r, body)
+		}
+		if err != nil {
+			decodeError(w, err)
+			return
+		}
+
+		if _, _, err := pipeline.PublishOnce(r.Context(), req.Id, req); err != nil {
+			log.Printf("❌ Failed to publish beacon: %v", err)
+			publishError(w, err)
+			return
+		}
+		log.Printf("✅ Beacon enqueued")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// eventFromQuery builds an event from pixel query parameters: the
+// EventRequest fields under their JSON names, and meta entries as
+// meta.<key>. The write key and cache busters are skipped; anything else is
+// rejected like an unknown JSON field.
+func eventFromQuery(q url.Values) (*ingestpb.EventRequest, error) {
+	req := &ingestpb.EventRequest{}
+	var unknown []ingest.FieldViolation
+	for name, values := range q {
+		v := values[0]
+		switch name {
+		case "id":
+			req.Id = v
+		case "user_id":
+			req.UserId = v
+		case "event_type":
+			req.EventType = v
+		case "url":
+			req.Url = v
+		case "referrer":
+			req.Referrer = v
+		case "ts":
+			req.Ts = v
+		case auth.QueryParam:
+		default:
+			if slices.Contains(cacheBusters, name) {
+				continue
+			}
+			key, ok := strings.CutPrefix(name, "meta.")
+			if !ok {
+				unknown = append(unknown, ingest.FieldViolation{Field: name, Description: "unknown field"})
+				continue
+			}
+			if req.Meta == nil {
+				req.Meta = map[string]string{}
+			}
+			req.Meta[key] = v
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &ingest.ValidationError{Violations: unknown}
+	}
+	return req, nil
+}
+
+// pixelHandler serves GET /e.gif: it publishes the event described by the
+// query string and answers with a 1x1 transparent GIF, for contexts that can
+// only load an image such as emails.
+func pixelHandler(pipeline *ingest.Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := eventFromQuery(r.URL.Query())
+		if err != nil {
+			decodeError(w, err)
+			return
+		}
+
+		// Mail clients and proxies often fetch the same image more than
+		// once, so a pixel with an id is only published once.
+		if _, _, err := pipeline.PublishOnce(r.Context(), req.Id, req); err != nil {
+			log.Printf("❌ Failed to publish pixel event: %v", err)
+			publishError(w, err)
+			return
+		}
+		log.Printf("✅ Pixel event enqueued")
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Content-Length", strconv.Itoa(len(transparentGIF)))
+		w.Write(transparentGIF)
+	}
+}
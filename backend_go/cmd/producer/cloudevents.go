@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+	"bigdata-perf/ratelimit"
+)
+
+// CloudEvents 1.0 over HTTP: structured mode carries the whole event as JSON,
+// batch mode a JSON array of them, and binary mode the attributes in ce-*
+// headers with the data as the body.
+const (
+	ceSpecVersion    = "1.0"
+	ceStructuredType = "application/cloudevents+json"
+	ceBatchType      = "application/cloudevents-batch+json"
+	ceHeaderPrefix   = "Ce-"
+)
+
+// ceSupportedMediaTypes is advertised when a request is rejected with 415.
+const ceSupportedMediaTypes = ceStructuredType + ", " + ceBatchType + ", or any type with ce-* headers"
+
+// ceAttributes are the context attributes defined by the spec; any other
+// attribute is an extension and goes into meta.
+var ceAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true,
+	"subject": true, "time": true, "datacontenttype": true, "dataschema": true,
+}
+
+// isJSONMediaType reports whether data of content type ct is JSON. An event
+// without datacontenttype is JSON in structured mode.
+func isJSONMediaType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		mt = strings.ToLower(ct)
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// validExtensionName reports whether name is a valid attribute name: lower
+// case ASCII letters and digits only.
+func validExtensionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// cloudEvent builds an event from CloudEvents attributes and data: type and
+// time map to event_type and ts, subject to user_id, and source, id,
+// dataschema and the extension attributes go into meta. The event id is
+// derived from source and id by ceEventID. JSON data is
+// flattened into meta under data.; other data is not stored. A violation of
+// the spec is reported as a ValidationError naming the attribute.
+func cloudEvent(attrs map[string]string, data any) (*ingestpb.EventRequest, error) {
+	var v []ingest.FieldViolation
+	add := func(field, description string) {
+		v = append(v, ingest.FieldViolation{Field: field, Description: description})
+	}
+	switch attrs["specversion"] {
+	case ceSpecVersion:
+	case "":
+		add("specversion", "is required")
+	default:
+		add("specversion", "unsupported version "+attrs["specversion"]+", expected "+ceSpecVersion)
+	}
+	for _, name := range []string{"id", "source", "type"} {
+		if attrs[name] == "" {
+			add(name, "is required")
+		}
+	}
+	if t := attrs["time"]; t != "" {
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			add("time", "must be an RFC 3339 timestamp")
+		}
+	}
+	if src := attrs["source"]; src != "" {
+		if _, err := url.Parse(src); err != nil {
+			add("source", "must be a URI-reference")
+		}
+	}
+
+	meta := map[string]string{"source": attrs["source"], "id": attrs["id"]}
+	if schema := attrs["dataschema"]; schema != "" {
+		meta["dataschema"] = schema
+	}
+	for name, value := range attrs {
+		if ceAttributes[name] {
+			continue
+		}
+		if !validExtensionName(name) {
+			add(name, "attribute names must be lower-case letters and digits")
+			continue
+		}
+		meta[name] = value
+	}
+	if data != nil {
+		flattenInto(meta, "data", data)
+	}
+	if len(v) > 0 {
+		return nil, &ingest.ValidationError{Violations: v}
+	}
+
+	return &ingestpb.EventRequest{
+		Id:        ceEventID(attrs["source"], attrs["id"]),
+		UserId:    attrs["subject"],
+		EventType: attrs["type"],
+		Ts:        attrs["time"],
+		Meta:      meta,
+	}, nil
+}
+
+// decodeJSONValue parses data keeping numbers as json.Number, as Segment
+// properties are.
+func decodeJSONValue(data []byte) (any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeStructured builds an event from a structured-mode event, a JSON
+// object of attributes plus data or data_base64.
+func decodeStructured(raw []byte) (*ingestpb.EventRequest, error) {
+	obj, err := decodeJSONValue(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	fields, ok := obj.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid json: event must be an object")
+	}
+
+	attrs := map[string]string{}
+	var bad []ingest.FieldViolation
+	for name, value := range fields {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			attrs[name] = value
+		case json.Number:
+			attrs[name] = value.String()
+		case bool:
+			attrs[name] = fmt.Sprint(value)
+		case nil:
+		default:
+			bad = append(bad, ingest.FieldViolation{Field: name, Description: "attribute values must be strings, numbers or booleans"})
+		}
+	}
+	if len(bad) > 0 {
+		return nil, &ingest.ValidationError{Violations: bad}
+	}
+
+	data, hasData := fields["data"]
+	if encoded, ok := fields["data_base64"]; ok && encoded != nil {
+		if hasData {
+			return nil, &ingest.ValidationError{Violations: []ingest.FieldViolation{{Field: "data_base64", Description: "must not be set together with data"}}}
+		}
+		s, _ := encoded.(string)
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, &ingest.ValidationError{Violations: []ingest.FieldViolation{{Field: "data_base64", Description: "must be base64"}}}
+		}
+		data = nil
+		if ct := attrs["datacontenttype"]; ct != "" && isJSONMediaType(ct) {
+			data, _ = decodeJSONValue(raw)
+		}
+	} else if ct := attrs["datacontenttype"]; ct != "" && !isJSONMediaType(ct) {
+		// A JSON string holding data of another type, e.g. XML.
+		data = nil
+	}
+	return cloudEvent(attrs, data)
+}
+
+// decodeBinary builds an event from a binary-mode request: attributes from
+// the percent-encoded ce-* headers, data from the body.
+func decodeBinary(r *http.Request, body []byte) (*ingestpb.EventRequest, error) {
+	attrs := map[string]string{}
+	for name, values := range r.Header {
+		attr, ok := strings.CutPrefix(name, ceHeaderPrefix)
+		if !ok {
+			continue
+		}
+		attr = strings.ToLower(attr)
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			return nil, &ingest.ValidationError{Violations: []ingest.FieldViolation{{Field: attr, Description: "invalid percent-encoding"}}}
+		}
+		attrs[attr] = value
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct != "" {
+		attrs["datacontenttype"] = ct
+	}
+
+	var data any
+	if len(body) > 0 && isJSONMediaType(ct) {
+		v, err := decodeJSONValue(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json data: %w", err)
+		}
+		data = v
+	}
+	return cloudEvent(attrs, data)
+}
+
+// ceEventID hashes source and id into an event id. CloudEvents ids are only
+// unique within a source, so different sources reusing an id such as "1"
+// must not be stored, or deduplicated, as the same event.
+func ceEventID(source, id string) string {
+	h := sha256.New()
+	h.Write([]byte(source))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// cloudEventsHandler serves /cloudevents in the three HTTP modes. A single
+// event answers like /events, and a batch like /events/batch, with each
+// event converted and published on its own; either way the event id, which
+// covers source and id, is the idempotency key.
+func cloudEventsHandler(pipeline *ingest.Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+
+		var req *ingestpb.EventRequest
+		switch mt := mediaType(r); {
+		case mt == ceBatchType:
+			var raw []json.RawMessage
+			if err := json.Unmarshal(body, &raw); err != nil {
+				decodeError(w, fmt.Errorf("invalid batch: %w", err))
+				return
+			}
+			if len(raw) > maxBatchEvents {
+				http.Error(w, fmt.Sprintf("batch too large: %d events (max %d)", len(raw), maxBatchEvents), http.StatusRequestEntityTooLarge)
+				return
+			}
+			items := make([]decodedEvent, len(raw))
+			for i, item := range raw {
+				items[i].req, items[i].err = decodeStructured(item)
+				if items[i].err == nil {
+					items[i].key = items[i].req.Id
+				}
+			}
+			if !ratelimit.ChargeHTTP(w, r, len(items)-1) {
+				return
+			}
+			resp, unavailable := publishBatch(r.Context(), pipeline, items)
+			writeBatchResponse(w, resp, unavailable)
+			return
+		case mt == ceStructuredType:
+			req, err = decodeStructured(body)
+		case r.Header.Get(ceHeaderPrefix+"Specversion") != "":
+			req, err = decodeBinary(r, body)
+		default:
+			w.Header().Set("Accept", ceStructuredType+", "+ceBatchType)
+			http.Error(w, fmt.Sprintf("%v, expected %s", errUnsupportedMediaType, ceSupportedMediaTypes), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			decodeError(w, err)
+			return
+		}
+
+		receipt, replayed, err := pipeline.PublishOnce(r.Context(), req.Id, req)
+		if err != nil {
+			log.Printf("❌ Failed to publish CloudEvent: %v", err)
+			publishError(w, err)
+			return
+		}
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		log.Printf("✅ CloudEvent %s enqueued", receipt.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": receipt.Status, "id": receipt.ID})
+	}
+}
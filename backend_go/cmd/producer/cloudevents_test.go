@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+)
+
+// violationFields returns the fields named by the violations of err.
+func violationFields(err error) []string {
+	var fields []string
+	for _, v := range ingest.Violations(err) {
+		fields = append(fields, v.Field)
+	}
+	return fields
+}
+
+func TestDecodeStructured(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       *ingestpb.EventRequest
+		violations []string
+		err        bool
+	}{
+		{
+			name: "full event",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/shop", "type": "order.placed",
+				"subject": "user-1", "time": "2024-06-01T12:00:00Z", "dataschema": "https://example.com/order.json",
+				"tenant": "acme", "data": {"order": {"total": 42, "items": [1, 2]}}}`,
+			want: &ingestpb.EventRequest{
+				Id: ceEventID("/shop", "e1"), UserId: "user-1", EventType: "order.placed", Ts: "2024-06-01T12:00:00Z",
+				Meta: map[string]string{
+					"source": "/shop", "id": "e1", "dataschema": "https://example.com/order.json", "tenant": "acme",
+					"data.order.total": "42", "data.order.items": "[1,2]",
+				},
+			},
+		},
+		{
+			name: "minimal event",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/shop", "type": "view"}`,
+			want: &ingestpb.EventRequest{Id: ceEventID("/shop", "e1"), EventType: "view", Meta: map[string]string{"source": "/shop", "id": "e1"}},
+		},
+		{
+			name: "extension values as strings",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "seq": 12345678901234567890, "sampled": true, "traceparent": null}`,
+			want: &ingestpb.EventRequest{Id: ceEventID("/s", "e1"), EventType: "t", Meta: map[string]string{"source": "/s", "id": "e1", "seq": "12345678901234567890", "sampled": "true"}},
+		},
+		{
+			name: "json data_base64",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "datacontenttype": "application/json", "data_base64": "eyJhIjogMX0="}`,
+			want: &ingestpb.EventRequest{Id: ceEventID("/s", "e1"), EventType: "t", Meta: map[string]string{"source": "/s", "id": "e1", "data.a": "1"}},
+		},
+		{
+			name: "binary data_base64 not stored",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "datacontenttype": "image/png", "data_base64": "iVBORw=="}`,
+			want: &ingestpb.EventRequest{Id: ceEventID("/s", "e1"), EventType: "t", Meta: map[string]string{"source": "/s", "id": "e1"}},
+		},
+		{
+			name: "xml data not stored",
+			body: `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "datacontenttype": "application/xml", "data": "<a/>"}`,
+			want: &ingestpb.EventRequest{Id: ceEventID("/s", "e1"), EventType: "t", Meta: map[string]string{"source": "/s", "id": "e1"}},
+		},
+		{
+			name:       "missing required attributes",
+			body:       `{"specversion": "1.0"}`,
+			violations: []string{"id", "source", "type"},
+		},
+		{
+			name:       "unsupported specversion",
+			body:       `{"specversion": "0.3", "id": "e1", "source": "/s", "type": "t"}`,
+			violations: []string{"specversion"},
+		},
+		{
+			name:       "bad time",
+			body:       `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "time": "yesterday"}`,
+			violations: []string{"time"},
+		},
+		{
+			name:       "bad extension name",
+			body:       `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "Tenant_ID": "x"}`,
+			violations: []string{"Tenant_ID"},
+		},
+		{
+			name:       "object attribute",
+			body:       `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "tags": {"a": 1}}`,
+			violations: []string{"tags"},
+		},
+		{
+			name:       "data and data_base64",
+			body:       `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "data": {}, "data_base64": "e30="}`,
+			violations: []string{"data_base64"},
+		},
+		{
+			name:       "invalid base64",
+			body:       `{"specversion": "1.0", "id": "e1", "source": "/s", "type": "t", "data_base64": "%%%"}`,
+			violations: []string{"data_base64"},
+		},
+		{name: "not an object", body: `["specversion"]`, err: true},
+		{name: "invalid json", body: `{"specversion": `, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeStructured([]byte(tt.body))
+			checkDecoded(t, got, err, tt.want, tt.violations, tt.err)
+		})
+	}
+}
+
+func TestDecodeBinary(t *testing.T) {
+	ceHeaders := map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "e1",
+		"ce-source":      "/shop",
+		"ce-type":        "order.placed",
+	}
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		contentType string
+		body        string
+		want        *ingestpb.EventRequest
+		violations  []string
+		err         bool
+	}{
+		{
+			name:        "json data",
+			headers:     map[string]string{"ce-subject": "user-1", "ce-time": "2024-06-01T12:00:00Z"},
+			contentType: "application/json",
+			body:        `{"total": 42}`,
+			want: &ingestpb.EventRequest{
+				Id: ceEventID("/shop", "e1"), UserId: "user-1", EventType: "order.placed", Ts: "2024-06-01T12:00:00Z",
+				Meta: map[string]string{"source": "/shop", "id": "e1", "data.total": "42"},
+			},
+		},
+		{
+			name:        "percent-encoded extension",
+			headers:     map[string]string{"ce-comment": "caf%C3%A9%20au%20lait"},
+			contentType: "text/plain",
+			body:        "ignored",
+			want:        &ingestpb.EventRequest{Id: ceEventID("/shop", "e1"), EventType: "order.placed", Meta: map[string]string{"source": "/shop", "id": "e1", "comment": "café au lait"}},
+		},
+		{
+			name:        "structured-suffix json data",
+			contentType: "application/vnd.order+json; charset=utf-8",
+			body:        `{"a": {"b": "c"}}`,
+			want:        &ingestpb.EventRequest{Id: ceEventID("/shop", "e1"), EventType: "order.placed", Meta: map[string]string{"source": "/shop", "id": "e1", "data.a.b": "c"}},
+		},
+		{
+			name:    "no body",
+			headers: map[string]string{"ce-dataschema": "https://example.com/s.json"},
+			want:    &ingestpb.EventRequest{Id: ceEventID("/shop", "e1"), EventType: "order.placed", Meta: map[string]string{"source": "/shop", "id": "e1", "dataschema": "https://example.com/s.json"}},
+		},
+		{
+			name:       "invalid percent-encoding",
+			headers:    map[string]string{"ce-comment": "50%"},
+			violations: []string{"comment"},
+		},
+		{
+			name:       "missing id",
+			headers:    map[string]string{"ce-id": ""},
+			violations: []string{"id"},
+		},
+		{
+			name:        "invalid json data",
+			contentType: "application/json",
+			body:        `{"total": `,
+			err:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/cloudevents", strings.NewReader(tt.body))
+			for k, v := range ceHeaders {
+				r.Header.Set(k, v)
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			got, err := decodeBinary(r, []byte(tt.body))
+			checkDecoded(t, got, err, tt.want, tt.violations, tt.err)
+		})
+	}
+}
+
+func checkDecoded(t *testing.T, got *ingestpb.EventRequest, err error, want *ingestpb.EventRequest, violations []string, wantErr bool) {
+	t.Helper()
+	switch {
+	case violations != nil:
+		fields := violationFields(err)
+		if !sameFields(fields, violations) {
+			t.Fatalf("violations on %v, want %v (err %v)", fields, violations, err)
+		}
+	case wantErr:
+		if err == nil || ingest.Violations(err) != nil {
+			t.Fatalf("err = %v, want a decoding error", err)
+		}
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	default:
+		if got.Id != want.Id || got.UserId != want.UserId || got.EventType != want.EventType || got.Ts != want.Ts {
+			t.Errorf("got id=%q user=%q type=%q ts=%q, want id=%q user=%q type=%q ts=%q",
+				got.Id, got.UserId, got.EventType, got.Ts, want.Id, want.UserId, want.EventType, want.Ts)
+		}
+		if !reflect.DeepEqual(got.Meta, want.Meta) {
+			t.Errorf("meta = %v, want %v", got.Meta, want.Meta)
+		}
+	}
+}
+
+// sameFields compares violation fields regardless of order, since attributes
+// are checked in map order.
+func sameFields(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, f := range got {
+		seen[f]++
+	}
+	for _, f := range want {
+		if seen[f] == 0 {
+			return false
+		}
+		seen[f]--
+	}
+	return true
+}
+
+func TestCEEventID(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  [2]string // source, id
+		equal bool
+	}{
+		{"same source and id", [2]string{"/shop", "42"}, [2]string{"/shop", "42"}, true},
+		{"id reused by another source", [2]string{"/shop", "42"}, [2]string{"/billing", "42"}, false},
+		{"boundary between source and id", [2]string{"/a", "b1"}, [2]string{"/ab", "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := ceEventID(tt.a[0], tt.a[1]), ceEventID(tt.b[0], tt.b[1])
+			if (a == b) != tt.equal {
+				t.Errorf("ceEventID%v = %s, ceEventID%v = %s; equal = %v, want %v", tt.a, a, tt.b, b, a == b, tt.equal)
+			}
+		})
+	}
+}
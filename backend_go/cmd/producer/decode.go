@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+)
+
+var errUnsupportedMediaType = errors.New("unsupported Content-Type")
+
+// supportedMediaTypes is advertised when a request is rejected with 415.
+const supportedMediaTypes = "application/json, application/x-ndjson, application/x-protobuf"
+
+// mediaType returns the media type of the request, treating a missing
+// Content-Type as JSON like the endpoint always has.
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return "application/json"
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(ct)
+	}
+	return mt
+}
+
+func isProtobuf(mt string) bool {
+	switch mt {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+		return true
+	}
+	return false
+}
+
+// unmarshalJSON decodes one JSON event, rejecting fields that EventRequest
+// does not have.
+func unmarshalJSON(data []byte, req *ingestpb.EventRequest) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		// encoding/json has no typed error for this case.
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return ingest.UnknownField(strings.Trim(name, `"`))
+		}
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid json: trailing data after event")
+	}
+	return nil
+}
+
+// decodeEvent parses a single event as JSON or as one protobuf
+// EventRequest, depending on the Content-Type.
+func decodeEvent(r *http.Request, body []byte) (*ingestpb.EventRequest, error) {
+	var req ingestpb.EventRequest
+	switch mt := mediaType(r); {
+	case mt == "application/json":
+		if err := unmarshalJSON(body, &req); err != nil {
+			return nil, err
+		}
+	case isProtobuf(mt):
+		if err := proto.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid protobuf: %w", err)
+		}
+	default:
+		return nil, errUnsupportedMediaType
+	}
+	return &req, nil
+}
+
+// decodedEvent is one batch item: the event, or why it could not be decoded.
+// key, when set, is the item's idempotency key.
+type decodedEvent struct {
+	req *ingestpb.EventRequest
+	err error
+	key string
+}
+
+// decodeBatch parses a batch body. JSON bodies are an array or NDJSON and are
+// decoded per item, so one bad item does not fail the rest. Protobuf bodies
+// are a stream of varint length-delimited EventRequest messages; a broken
+// message breaks the framing, so it fails the whole batch.
+func decodeBatch(r *http.Request, body []byte) ([]decodedEvent, error) {
+	mt := mediaType(r)
+	switch {
+	case mt == "application/json" || mt == "application/x-ndjson":
+		items, err := splitBatch(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch: %w", err)
+		}
+		events := make([]decodedEvent, len(items))
+		for i, item := range items {
+			var req ingestpb.EventRequest
+			if err := unmarshalJSON(item, &req); err != nil {
+				events[i].err = err
+				continue
+			}
+			events[i].req = &req
+		}
+		return events, nil
+
+	case isProtobuf(mt):
+		br := bufio.NewReader(bytes.NewReader(body))
+		opts := protodelim.UnmarshalOptions{MaxSize: maxDecodedBytes}
+		events := []decodedEvent{}
+		for {
+			var req ingestpb.EventRequest
+			err := opts.UnmarshalFrom(br, &req)
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid protobuf message %d: %w", len(events), err)
+			}
+			events = append(events, decodedEvent{req: &req})
+		}
+	}
+	return nil, errUnsupportedMediaType
+}
+
+// decodeError writes the HTTP error for a failed decode.
+func decodeError(w http.ResponseWriter, err error) {
+	log.Printf("❌ %v", err)
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		w.Header().Set("Accept", supportedMediaTypes)
+		http.Error(w, fmt.Sprintf("%v, expected one of: %s", err, supportedMediaTypes), http.StatusUnsupportedMediaType)
+	case ingest.Violations(err) != nil:
+		validationError(w, err)
+	default:
+		http.Error(w, err.Error(), 400)
+	}
+}
+
+// validationError writes a 400 listing the invalid fields of an event.
+func validationError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":      "invalid event",
+		"violations": ingest.Violations(err),
+	})
+}
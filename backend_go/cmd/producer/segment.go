@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"bigdata-perf/ingest"
+	ingestpb "bigdata-perf/proto"
+	"bigdata-perf/ratelimit"
+)
+
+// Segment call types with their own endpoint. Other types (screen, group,
+// alias) are accepted inside /v1/batch.
+const (
+	segmentTrack    = "track"
+	segmentPage     = "page"
+	segmentIdentify = "identify"
+)
+
+// segmentMessage is one call of the Segment HTTP tracking API, which
+// RudderStack also speaks. Only the fields the pipeline stores are decoded.
+type segmentMessage struct {
+	Type        string `json:"type"`
+	Event       string `json:"event"`
+	Name        string `json:"name"`
+	MessageID   string `json:"messageId"`
+	UserID      string `json:"userId"`
+	AnonymousID string `json:"anonymousId"`
+	Timestamp   string `json:"timestamp"`
+	// OriginalTimestamp is sent instead of timestamp by RudderStack SDKs.
+	OriginalTimestamp string         `json:"originalTimestamp"`
+	Properties        map[string]any `json:"properties"`
+	Traits            map[string]any `json:"traits"`
+	Context           struct {
+		Page struct {
+			URL      string `json:"url"`
+			Referrer string `json:"referrer"`
+		} `json:"page"`
+		// Traits is where newer SDKs put identify traits.
+		Traits map[string]any `json:"traits"`
+	} `json:"context"`
+}
+
+// decodeSegment parses one Segment message. Numbers are kept as json.Number
+// so large ids survive flattening into meta.
+func decodeSegment(data []byte) (*segmentMessage, error) {
+	var msg segmentMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	return &msg, nil
+}
+
+// event maps msg onto an EventRequest: event_type is the track event name,
+// or the call type for other calls; user_id falls back to anonymousId;
+// messageId becomes the event id; the page url and referrer come from
+// context.page, or from the properties of page calls. Properties (traits for
+// identify) are flattened into meta with dotted keys.
+func (msg *segmentMessage) event() *ingestpb.EventRequest {
+	req := &ingestpb.EventRequest{
+		Id:        msg.MessageID,
+		UserId:    msg.UserID,
+		EventType: msg.Type,
+		Url:       msg.Context.Page.URL,
+		Referrer:  msg.Context.Page.Referrer,
+		Ts:        msg.Timestamp,
+	}
+	if msg.Type == segmentTrack {
+		req.EventType = msg.Event
+	}
+	if req.UserId == "" {
+		req.UserId = msg.AnonymousID
+	}
+	if req.Ts == "" {
+		req.Ts = msg.OriginalTimestamp
+	}
+
+	meta := map[string]string{}
+	props := msg.Properties
+	if msg.Type == segmentIdentify {
+		props = msg.Traits
+		if props == nil {
+			props = msg.Context.Traits
+		}
+	}
+	for k, v := range props {
+		flattenInto(meta, k, v)
+	}
+	if msg.Type == segmentPage {
+		if req.Url == "" {
+			req.Url = meta["url"]
+		}
+		if req.Referrer == "" {
+			req.Referrer = meta["referrer"]
+		}
+		if msg.Name != "" {
+			meta["name"] = msg.Name
+		}
+	}
+	if msg.UserID != "" && msg.AnonymousID != "" {
+		meta["anonymous_id"] = msg.AnonymousID
+	}
+	if len(meta) > 0 {
+		req.Meta = meta
+	}
+	return req
+}
+
+// flattenInto stores v in meta under key, joining the keys of nested objects
+// with dots. Arrays are stored as JSON and nulls are skipped.
+func flattenInto(meta map[string]string, key string, v any) {
+	switch v := v.(type) {
+	case nil:
+	case string:
+		meta[key] = v
+	case json.Number:
+		meta[key] = v.String()
+	case bool:
+		if v {
+			meta[key] = "true"
+		} else {
+			meta[key] = "false"
+		}
+	case map[string]any:
+		for k, sub := range v {
+			flattenInto(meta, key+"."+k, sub)
+		}
+	default:
+		data, _ := json.Marshal(v)
+		meta[key] = string(data)
+	}
+}
+
+// segmentHandler serves /v1/track, /v1/page and /v1/identify. The endpoint
+// sets the call type, and messageId doubles as the idempotency key since SDKs
+// resend it on retries.
+func segmentHandler(pipeline *ingest.Pipeline, callType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+
+		msg, err := decodeSegment(body)
+		if err != nil {
+			decodeError(w, err)
+			return
+		}
+		msg.Type = callType
+
+		receipt, _, err := pipeline.PublishOnce(r.Context(), msg.MessageID, msg.event())
+		if err != nil {
+			log.Printf("❌ Failed to publish %s call: %v", callType, err)
+			publishError(w, err)
+			return
+		}
+		log.Printf("✅ Segment %s call enqueued", callType)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "status": receipt.Status, "id": receipt.ID})
+	}
+}
+
+// segmentBatchHandler serves /v1/batch: {"batch": [...]} with each message
+// carrying its own type. Messages are decoded and published one by one, so a
+// bad message does not fail the rest, and the response is that of
+// /events/batch. As on the single-call endpoints, messageId is the
+// idempotency key of each message.
+func segmentBatchHandler(pipeline *ingest.Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+
+		var payload struct {
+			Batch []json.RawMessage `json:"batch"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			decodeError(w, fmt.Errorf("invalid batch: %w", err))
+			return
+		}
+		if len(payload.Batch) == 0 {
+			http.Error(w, "empty batch", 400)
+			return
+		}
+		if len(payload.Batch) > maxBatchEvents {
+			http.Error(w, fmt.Sprintf("batch too large: %d events (max %d)", len(payload.Batch), maxBatchEvents), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		items := make([]decodedEvent, len(payload.Batch))
+		for i, raw := range payload.Batch {
+			msg, err := decodeSegment(raw)
+			if err != nil {
+				items[i].err = err
+				continue
+			}
+			if msg.Type == "" {
+				items[i].err = &ingest.ValidationError{Violations: []ingest.FieldViolation{{Field: "type", Description: "is required"}}}
+				continue
+			}
+			items[i].req, items[i].key = msg.event(), msg.MessageID
+		}
+
+		if !ratelimit.ChargeHTTP(w, r, len(items)-1) {
+			return
+		}
+		resp, unavailable := publishBatch(r.Context(), pipeline, items)
+		writeBatchResponse(w, resp, unavailable)
+	}
+}
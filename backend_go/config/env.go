@@ -0,0 +1,78 @@
+// Package config reads service settings from environment variables, falling
+// back to a default (with a log line) when a value is missing or malformed.
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// String returns the value of key, or def when it is unset.
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// List returns key split on commas with blanks dropped, or def when it is
+// unset.
+func List(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Int returns key parsed as an integer, or def when it is unset or invalid.
+func Int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, defaulting to %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// Float returns key parsed as a float, or def when it is unset or invalid.
+func Float(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, defaulting to %g", key, v, def)
+		return def
+	}
+	return f
+}
+
+// Duration returns key parsed with time.ParseDuration, or def when it is
+// unset or invalid.
+func Duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, defaulting to %s", key, v, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,131 @@
+// Package geoip looks up client IPs in a local MaxMind-format (.mmdb) city
+// database, such as GeoLite2-City or DB-IP City Lite, reloaded whenever the
+// file changes so it can be updated without a restart.
+package geoip
+
+import (
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"bigdata-perf/config"
+)
+
+// Location is where an IP was found to be. Country is the ISO 3166-1 alpha-2
+// code; Region and City are English names. Fields are empty when the database
+// does not know them.
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// record is the subset of the city database schema we read.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// DB is a hot-reloaded geolocation database. A nil *DB finds nothing.
+type DB struct {
+	path string
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+// FromEnv opens the database named by GEOIP_DB, polled for changes every
+// GEOIP_RELOAD. It returns a nil DB, disabling geolocation, when GEOIP_DB is
+// unset.
+func FromEnv() (*DB, error) {
+	path := config.String("GEOIP_DB", "")
+	if path == "" {
+		log.Println("⚠️  GEOIP_DB not set, geo enrichment disabled")
+		return nil, nil
+	}
+	return Open(path, config.Duration("GEOIP_RELOAD", time.Minute))
+}
+
+// Open reads path and polls it for changes every interval.
+func Open(path string, interval time.Duration) (*DB, error) {
+	db := &DB{path: path}
+	if err := db.reload(); err != nil {
+		return nil, err
+	}
+	go db.watch(interval)
+	return db, nil
+}
+
+// Lookup returns the location of ip, and false when the database has no
+// entry for it.
+func (db *DB) Lookup(ip netip.Addr) (Location, bool) {
+	if db == nil || !ip.IsValid() || ip.IsPrivate() || ip.IsLoopback() {
+		return Location{}, false
+	}
+	db.mu.RLock()
+	reader := db.reader
+	db.mu.RUnlock()
+
+	var rec record
+	if err := reader.Lookup(net.IP(ip.AsSlice()), &rec); err != nil {
+		return Location{}, false
+	}
+	loc := Location{Country: rec.Country.ISOCode, City: rec.City.Names["en"]}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].Names["en"]
+	}
+	return loc, loc != Location{}
+}
+
+func (db *DB) reload() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+	db.mu.RLock()
+	unchanged := info.ModTime().Equal(db.modTime)
+	db.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	// Read the file into memory rather than mmap it, so a reader still in
+	// use by a lookup stays valid after it is swapped out.
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	db.reader, db.modTime = reader, info.ModTime()
+	db.mu.Unlock()
+	log.Printf("🌍 Loaded GeoIP database %s (%s, built %s)", db.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.DateOnly))
+	return nil
+}
+
+func (db *DB) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		// On a bad or half-written file keep serving the last good one.
+		if err := db.reload(); err != nil {
+			log.Printf("❌ GeoIP reload failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ServeGRPC keeps the grpc.health.v1 status of server and of each named
+// service in step with the readiness checks, re-evaluating every interval
+// until ctx is done.
+func (c *Checker) ServeGRPC(ctx context.Context, server *grpchealth.Server, interval time.Duration, services ...string) {
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if _, ready := c.Run(ctx); !ready {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		server.SetServingStatus("", status)
+		for _, svc := range services {
+			server.SetServingStatus(svc, status)
+		}
+	}
+
+	update()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package health serves liveness and readiness probes that reflect the state
+// of a service's real dependencies.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a single readiness check.
+const checkTimeout = 2 * time.Second
+
+// Check returns nil when the dependency it covers is usable.
+type Check func(ctx context.Context) error
+
+// Checker runs named readiness checks.
+type Checker struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+func New() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// Add registers a readiness check under name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs every check and returns each result by name ("ok" or the error),
+// and whether all of them passed.
+func (c *Checker) Run(ctx context.Context) (map[string]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	results := make(map[string]string, len(c.names))
+	ready := true
+	for _, name := range c.names {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := c.checks[name](checkCtx)
+		cancel()
+		if err != nil {
+			results[name] = err.Error()
+			ready = false
+			continue
+		}
+		results[name] = "ok"
+	}
+	return results, ready
+}
+
+// Liveness serves /healthz: it only says the process is up.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// Readiness serves /readyz: 503 until every check passes.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	results, ready := c.Run(r.Context())
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not ready", "checks": results})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "checks": results})
+}
+
+// Register mounts /healthz and /readyz on mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.Liveness)
+	mux.HandleFunc("/readyz", c.Readiness)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
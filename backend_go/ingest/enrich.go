@@ -0,0 +1,76 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mileusna/useragent"
+
+	"bigdata-perf/clientinfo"
+	ingestpb "bigdata-perf/proto"
+)
+
+// maxUserAgentLen caps the stored User-Agent; real ones are far shorter.
+const maxUserAgentLen = 512
+
+// Device types stored in device_type.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+func deviceType(ua useragent.UserAgent) string {
+	switch {
+	case ua.Bot:
+		return DeviceBot
+	case ua.Tablet:
+		return DeviceTablet
+	case ua.Mobile:
+		return DeviceMobile
+	case ua.Desktop:
+		return DeviceDesktop
+	}
+	return ""
+}
+
+// enrich fills the client fields of req from the client info that the
+// transport stored in ctx, replacing whatever the client sent in them. The
+// IP is located with the full address, then truncated to the configured
+// prefix lengths.
+func (p *Pipeline) enrich(ctx context.Context, req *ingestpb.EventRequest) {
+	req.ClientIp = ""
+	req.UserAgent = ""
+	req.Browser, req.BrowserVersion = "", ""
+	req.Os, req.OsVersion = "", ""
+	req.DeviceType = ""
+	req.Country, req.Region, req.City = "", "", ""
+
+	info, ok := clientinfo.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if loc, ok := p.geo.Lookup(info.IP); ok {
+		req.Country, req.Region, req.City = loc.Country, loc.Region, loc.City
+	}
+	if info.IP.IsValid() {
+		req.ClientIp = clientinfo.Truncate(info.IP, p.ipV4Bits, p.ipV6Bits).String()
+	}
+	if info.UserAgent == "" {
+		return
+	}
+
+	// Header values are not guaranteed to be UTF-8, which proto3 strings
+	// require.
+	raw := info.UserAgent
+	if len(raw) > maxUserAgentLen {
+		raw = raw[:maxUserAgentLen]
+	}
+	req.UserAgent = strings.ToValidUTF8(raw, "")
+
+	ua := useragent.Parse(req.UserAgent)
+	req.Browser, req.BrowserVersion = ua.Name, ua.Version
+	req.Os, req.OsVersion = ua.OS, ua.OSVersion
+	req.DeviceType = deviceType(ua)
+}
@@ -0,0 +1,16 @@
+package ingest
+
+import (
+	"github.com/google/uuid"
+)
+
+// NewID returns a UUIDv7: unique across processes and, because the leading
+// bits are a millisecond timestamp, sortable by creation time.
+func NewID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		// Only fails if the system random source is broken.
+		return uuid.NewString()
+	}
+	return id.String()
+}
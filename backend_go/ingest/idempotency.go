@@ -0,0 +1,165 @@
+package ingest
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// idempotencyEntry is the first result seen for a key. done is closed once
+// the result is known, so concurrent retries wait for the original call.
+type idempotencyEntry struct {
+	key     string
+	done    chan struct{}
+	receipt Receipt
+	expires time.Time
+	elem    *list.Element
+}
+
+// IdempotencyStore remembers the outcome of keyed publishes for a window, so
+// a retried request returns the original result instead of publishing again.
+// It is per process; duplicates that slip through (e.g. retries landing on
+// another replica) are collapsed by the ReplacingMergeTree table.
+//
+// Every key lives for the same window, so the keys are kept in a list in
+// expiry order. At maxKeys the oldest key is forgotten to make room, which
+// only shortens its window.
+type IdempotencyStore struct {
+	window  time.Duration
+	maxKeys int
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	order   *list.List // of *idempotencyEntry, oldest first
+}
+
+// NewIdempotencyStore keeps results for window, for at most maxKeys keys. A
+// zero window disables it; a zero maxKeys leaves it unbounded.
+func NewIdempotencyStore(window time.Duration, maxKeys int) *IdempotencyStore {
+	s := &IdempotencyStore{
+		window:  window,
+		maxKeys: maxKeys,
+		entries: map[string]*idempotencyEntry{},
+		order:   list.New(),
+	}
+	if window > 0 {
+		go s.sweep()
+	}
+	return s
+}
+
+// Do runs fn once per key. Calls with a key already seen within the window
+// wait for and return the first call's receipt, with replayed set. Failed
+// calls are forgotten so the client can retry them.
+func (s *IdempotencyStore) Do(ctx context.Context, key string, fn func() (*Receipt, error)) (receipt *Receipt, replayed bool, err error) {
+	if s == nil || s.window <= 0 || key == "" {
+		receipt, err = fn()
+		return receipt, false, err
+	}
+
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.expires) {
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-e.done:
+		}
+		if e.receipt.ID == "" {
+			// The original call failed; let this one try again.
+			return s.Do(ctx, key, fn)
+		}
+		r := e.receipt
+		return &r, true, nil
+	}
+	e := s.add(key)
+	s.mu.Unlock()
+
+	receipt, err = fn()
+	s.settle(e, receipt, err)
+	return receipt, false, err
+}
+
+// Claim is Do for callers that send and confirm in separate steps, such as
+// batches. It returns the receipt of a publish of key that succeeded within
+// the window. Otherwise it claims key and returns settle, which the caller
+// must call with the outcome of its publish. It does not wait for a call
+// still publishing key: it returns neither, and the caller publishes without
+// the key, leaving the duplicate to ClickHouse.
+func (s *IdempotencyStore) Claim(key string) (receipt *Receipt, settle func(*Receipt, error)) {
+	if s == nil || s.window <= 0 || key == "" {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.expires) {
+		select {
+		case <-e.done:
+			if e.receipt.ID == "" {
+				return nil, nil
+			}
+			r := e.receipt
+			return &r, nil
+		default:
+			return nil, nil
+		}
+	}
+	e := s.add(key)
+	return nil, func(receipt *Receipt, err error) { s.settle(e, receipt, err) }
+}
+
+// add claims key with a new entry, replacing an expired one and evicting the
+// oldest keys past maxKeys. Callers hold s.mu.
+func (s *IdempotencyStore) add(key string) *idempotencyEntry {
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	e := &idempotencyEntry{key: key, done: make(chan struct{}), expires: time.Now().Add(s.window)}
+	e.elem = s.order.PushBack(e)
+	s.entries[key] = e
+	for s.maxKeys > 0 && len(s.entries) > s.maxKeys {
+		s.remove(s.order.Front().Value.(*idempotencyEntry))
+	}
+	return e
+}
+
+// settle records the outcome of the publish that claimed e. A failed publish
+// is forgotten.
+func (s *IdempotencyStore) settle(e *idempotencyEntry, receipt *Receipt, err error) {
+	s.mu.Lock()
+	if err != nil {
+		if s.entries[e.key] == e {
+			s.remove(e)
+		}
+	} else {
+		e.receipt = Receipt{ID: receipt.ID, Status: receipt.Status}
+	}
+	s.mu.Unlock()
+	close(e.done)
+}
+
+// remove forgets e. Callers hold s.mu.
+func (s *IdempotencyStore) remove(e *idempotencyEntry) {
+	delete(s.entries, e.key)
+	s.order.Remove(e.elem)
+}
+
+// sweep drops expired keys, walking the list only as far as the first key
+// still in its window.
+func (s *IdempotencyStore) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.mu.Lock()
+		for front := s.order.Front(); front != nil; front = s.order.Front() {
+			e := front.Value.(*idempotencyEntry)
+			if !now.After(e.expires) {
+				break
+			}
+			s.remove(e)
+		}
+		s.mu.Unlock()
+	}
+}
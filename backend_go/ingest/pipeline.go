@@ -0,0 +1,311 @@
+// Package ingest holds the event handling shared by the HTTP producer and
+// the gRPC server, so both ingest paths stamp and encode events the same way.
+package ingest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"bigdata-perf/auth"
+	"bigdata-perf/broker"
+	"bigdata-perf/config"
+	"bigdata-perf/geoip"
+	"bigdata-perf/metrics"
+	ingestpb "bigdata-perf/proto"
+	"bigdata-perf/sampling"
+	"bigdata-perf/scrub"
+	"bigdata-perf/spool"
+)
+
+// Statuses reported back to clients for a published event.
+const (
+	StatusQueued      = "queued"
+	StatusQuarantined = "quarantined"
+	// StatusSpooled means the broker was unavailable and the event was
+	// written to the local spool, to be published when it is back.
+	StatusSpooled = "spooled"
+	// StatusDropped and StatusSampledOut mean a sampling rule discarded the
+	// event; it is accepted but never published.
+	StatusDropped    = "dropped"
+	StatusSampledOut = "sampled_out"
+)
+
+// Config holds the pipeline policies.
+type Config struct {
+	Timestamps        TimestampPolicy
+	IdempotencyWindow time.Duration
+	// IdempotencyMaxKeys caps how many keys are remembered; the oldest are
+	// forgotten first.
+	IdempotencyMaxKeys int
+	// ClientIPv4Bits and ClientIPv6Bits are how many leading bits of the
+	// client IP are kept; the rest is zeroed.
+	ClientIPv4Bits int
+	ClientIPv6Bits int
+	// GeoIP, when set, locates the client IP.
+	GeoIP *geoip.DB
+	// Scrubber, when set, removes personal data before publishing.
+	Scrubber *scrub.Scrubber
+	// Spool, when set, keeps events the broker could not take.
+	Spool *spool.Spool
+	// Sampler, when set, drops or samples events by type.
+	Sampler *sampling.Sampler
+}
+
+// ConfigFromEnv reads the pipeline policies from the environment.
+func ConfigFromEnv() Config {
+	return Config{
+		Timestamps:         TimestampPolicyFromEnv(),
+		IdempotencyWindow:  config.Duration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		IdempotencyMaxKeys: config.Int("IDEMPOTENCY_MAX_KEYS", 1000000),
+		ClientIPv4Bits:     config.Int("CLIENT_IP_V4_PREFIX", 32),
+		ClientIPv6Bits:     config.Int("CLIENT_IP_V6_PREFIX", 128),
+	}
+}
+
+// Pipeline prepares incoming events and publishes them to RabbitMQ.
+type Pipeline struct {
+	publisher   *broker.Publisher
+	timestamps  TimestampPolicy
+	idempotency *IdempotencyStore
+	ipV4Bits    int
+	ipV6Bits    int
+	geo         *geoip.DB
+	scrubber    *scrub.Scrubber
+	spool       *spool.Spool
+	sampler     *sampling.Sampler
+}
+
+func NewPipeline(pub *broker.Publisher, cfg Config) *Pipeline {
+	return &Pipeline{
+		publisher:   pub,
+		timestamps:  cfg.Timestamps,
+		idempotency: NewIdempotencyStore(cfg.IdempotencyWindow, cfg.IdempotencyMaxKeys),
+		ipV4Bits:    cfg.ClientIPv4Bits,
+		ipV6Bits:    cfg.ClientIPv6Bits,
+		geo:         cfg.GeoIP,
+		scrubber:    cfg.Scrubber,
+		spool:       cfg.Spool,
+		sampler:     cfg.Sampler,
+	}
+}
+
+// Receipt identifies a sent event. Pass it to Await to wait for the broker.
+type Receipt struct {
+	ID       string
+	Status   string
+	confirm  *broker.Confirmation
+	endpoint string
+	// key and data are kept until the confirm, to spool the event if the
+	// broker does not take it.
+	key  string
+	data []byte
+	// replayed marks the receipt of an earlier publish returned by SendOnce;
+	// settle records the outcome of a publish SendOnce claimed a key for.
+	replayed bool
+	settle   func(*Receipt, error)
+}
+
+// countEvent records the outcome of one event in the per-endpoint event
+// counter.
+func countEvent(endpoint string, err error, status string) {
+	result := status
+	switch {
+	case err == nil:
+	case Violations(err) != nil:
+		result = "invalid"
+	case broker.IsRetryable(err):
+		result = "unavailable"
+	default:
+		result = "error"
+	}
+	metrics.IngestEvents.WithLabelValues(endpoint, result).Inc()
+}
+
+// prepare assigns the server-side fields of an incoming event: a generated id
+// when the client did not send one, the receive time, and the ts chosen by
+// the timestamp policy, plus the project of the authenticated write key and
+// the client details. It then applies the scrub rules, so nothing after it
+// sees the removed data. It reports whether the event must be quarantined.
+func (p *Pipeline) prepare(ctx context.Context, req *ingestpb.EventRequest) (bool, error) {
+	now := time.Now().UTC()
+	ts, quarantine, err := p.timestamps.resolve(req.Ts, now)
+	if err != nil {
+		return false, err
+	}
+
+	if req.Id == "" {
+		req.Id = NewID()
+	}
+	req.Ts = ts.UTC().Format(time.RFC3339)
+	req.ReceivedAt = now.Format(time.RFC3339)
+
+	// Never trust a client-sent project; only the write key decides it.
+	req.Project = ""
+	if k, ok := auth.FromContext(ctx); ok {
+		req.Project = k.Project
+	}
+	p.enrich(ctx, req)
+	p.scrubber.Apply(req)
+	return quarantine, nil
+}
+
+// Send validates, prepares and publishes req without waiting for the broker
+// confirm. Events that fail here are counted under the endpoint of ctx;
+// Await counts the rest.
+func (p *Pipeline) Send(ctx context.Context, req *ingestpb.EventRequest) (*Receipt, error) {
+	r, err := p.send(ctx, req)
+	if err != nil {
+		countEvent(metrics.Endpoint(ctx), err, "")
+	}
+	return r, err
+}
+
+func (p *Pipeline) send(ctx context.Context, req *ingestpb.EventRequest) (*Receipt, error) {
+	if err := Validate(req); err != nil {
+		return nil, err
+	}
+	// Sample on the raw user id, before scrubbing may hash it, and before
+	// spending any work on events that are discarded.
+	decision := p.sampler.Decide(req)
+	req.SampleRate = decision.Rate
+	if !decision.Keep {
+		status := StatusSampledOut
+		if decision.Action == sampling.ActionDrop {
+			status = StatusDropped
+		}
+		if req.Id == "" {
+			req.Id = NewID()
+		}
+		return &Receipt{ID: req.Id, Status: status, endpoint: metrics.Endpoint(ctx)}, nil
+	}
+	quarantine, err := p.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✅ Parsed event %s (%s)", req.Id, req.EventType)
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key, status := broker.RoutingKey(req.EventType), StatusQueued
+	if quarantine {
+		key, status = broker.QuarantineKey(req.EventType), StatusQuarantined
+		log.Printf("⚠️  Quarantining event %s: ts %s outside skew window", req.Id, req.Ts)
+	}
+
+	r := &Receipt{ID: req.Id, Status: status, endpoint: metrics.Endpoint(ctx), key: key, data: data}
+	r.confirm, err = p.publisher.Send(ctx, key, data)
+	if err != nil {
+		if err := p.spoolEvent(r, err); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// spoolEvent writes the event of r to the spool after the broker failed to
+// take it with err. It returns err when the failure is not a broker outage,
+// or there is no spool or it is full.
+func (p *Pipeline) spoolEvent(r *Receipt, err error) error {
+	if p.spool == nil || !broker.IsRetryable(err) {
+		return err
+	}
+	if spoolErr := p.spool.Append(r.key, r.data); spoolErr != nil {
+		log.Printf("❌ Failed to spool event %s: %v", r.ID, spoolErr)
+		return err
+	}
+	log.Printf("📦 Broker unavailable (%v), spooled event %s", err, r.ID)
+	r.Status, r.confirm = StatusSpooled, nil
+	return nil
+}
+
+// Await waits for the broker to confirm a sent event, spooling it when the
+// broker does not take it. A spooled event may still have reached the broker
+// (e.g. after a confirm timeout) and be published twice under the same id.
+func (p *Pipeline) Await(ctx context.Context, r *Receipt) error {
+	if r.replayed {
+		metrics.IngestEvents.WithLabelValues(r.endpoint, "replayed").Inc()
+		return nil
+	}
+	var err error
+	if r.confirm != nil {
+		if err = p.publisher.Await(ctx, r.confirm); err != nil {
+			err = p.spoolEvent(r, err)
+		}
+	}
+	// Receipts are kept for idempotent replays; the event body is not needed.
+	r.data = nil
+	if r.settle != nil {
+		r.settle(r, err)
+		r.settle = nil
+	}
+	countEvent(r.endpoint, err, r.Status)
+	return err
+}
+
+// Publish sends req and waits for its confirm.
+func (p *Pipeline) Publish(ctx context.Context, req *ingestpb.EventRequest) (*Receipt, error) {
+	r, err := p.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return r, p.Await(ctx, r)
+}
+
+// PublishOnce publishes req unless key was already published within the
+// idempotency window, in which case the original receipt is returned with
+// replayed set. An empty key always publishes. Keys are scoped to the
+// project of the write key.
+func (p *Pipeline) PublishOnce(ctx context.Context, key string, req *ingestpb.EventRequest) (receipt *Receipt, replayed bool, err error) {
+	receipt, replayed, err = p.idempotency.Do(ctx, projectKey(ctx, key), func() (*Receipt, error) {
+		return p.Publish(ctx, req)
+	})
+	if replayed {
+		metrics.IngestEvents.WithLabelValues(metrics.Endpoint(ctx), "replayed").Inc()
+	}
+	return receipt, replayed, err
+}
+
+// Replayed reports whether r is the receipt of an earlier publish, returned
+// by SendOnce instead of publishing again.
+func (r *Receipt) Replayed() bool {
+	return r.replayed
+}
+
+// SendOnce is Send with key as idempotency key, for batches that send every
+// event before awaiting any: when key was already published within the
+// window it returns the original receipt with replayed set and publishes
+// nothing; Await of that receipt returns at once. Unlike PublishOnce it does
+// not wait for a request still publishing key, which may be an earlier event
+// of the same batch; the event is then published again under the same id,
+// and ClickHouse collapses the two.
+func (p *Pipeline) SendOnce(ctx context.Context, key string, req *ingestpb.EventRequest) (receipt *Receipt, replayed bool, err error) {
+	original, settle := p.idempotency.Claim(projectKey(ctx, key))
+	if original != nil {
+		original.replayed, original.endpoint = true, metrics.Endpoint(ctx)
+		return original, true, nil
+	}
+	receipt, err = p.Send(ctx, req)
+	if settle != nil {
+		if err != nil {
+			settle(nil, err)
+		} else {
+			receipt.settle = settle
+		}
+	}
+	return receipt, false, err
+}
+
+// projectKey scopes an idempotency key to the project of the write key, so
+// projects cannot replay each other's receipts.
+func projectKey(ctx context.Context, key string) string {
+	if k, ok := auth.FromContext(ctx); ok && key != "" {
+		return k.Project + ":" + key
+	}
+	return key
+}
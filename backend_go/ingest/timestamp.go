@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"bigdata-perf/config"
+)
+
+// ErrTimestampSkew is returned for a client timestamp outside the allowed
+// skew window when the policy is SkewReject.
+var ErrTimestampSkew = errors.New("event ts outside allowed clock skew")
+
+// What to do with a client timestamp outside [now-MaxPast, now+MaxFuture].
+const (
+	SkewClamp      = "clamp"      // move ts to the nearest edge of the window
+	SkewReject     = "reject"     // refuse the event
+	SkewQuarantine = "quarantine" // keep ts as sent, but route to the quarantine queue
+)
+
+// TimestampPolicy decides which ts an event is stored with. Events without a
+// ts get the server receive time.
+type TimestampPolicy struct {
+	MaxPast   time.Duration
+	MaxFuture time.Duration
+	Action    string
+}
+
+// TimestampPolicyFromEnv reads TS_MAX_PAST, TS_MAX_FUTURE and TS_SKEW_POLICY.
+func TimestampPolicyFromEnv() TimestampPolicy {
+	p := TimestampPolicy{
+		MaxPast:   config.Duration("TS_MAX_PAST", 72*time.Hour),
+		MaxFuture: config.Duration("TS_MAX_FUTURE", 5*time.Minute),
+		Action:    config.String("TS_SKEW_POLICY", SkewClamp),
+	}
+	switch p.Action {
+	case SkewClamp, SkewReject, SkewQuarantine:
+	default:
+		log.Printf("⚠️  Unknown TS_SKEW_POLICY=%q, defaulting to %s", p.Action, SkewClamp)
+		p.Action = SkewClamp
+	}
+	return p
+}
+
+// resolve returns the ts to store for a client value received at now, and
+// whether the event should be quarantined. Unparseable values count as out
+// of range.
+func (p TimestampPolicy) resolve(clientTS string, now time.Time) (time.Time, bool, error) {
+	if clientTS == "" {
+		return now, false, nil
+	}
+
+	earliest, latest := now.Add(-p.MaxPast), now.Add(p.MaxFuture)
+	ts, err := time.Parse(time.RFC3339, clientTS)
+	if err == nil && !ts.Before(earliest) && !ts.After(latest) {
+		return ts, false, nil
+	}
+
+	switch p.Action {
+	case SkewReject:
+		return time.Time{}, false, ErrTimestampSkew
+	case SkewQuarantine:
+		if err != nil {
+			return now, true, nil
+		}
+		return ts, true, nil
+	default:
+		switch {
+		case err != nil:
+			return now, false, nil
+		case ts.Before(earliest):
+			return earliest, false, nil
+		default:
+			return latest, false, nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimestampPolicyResolve(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	earliest := now.Add(-72 * time.Hour)
+	latest := now.Add(5 * time.Minute)
+
+	tests := []struct {
+		name       string
+		action     string
+		clientTS   string
+		want       time.Time
+		quarantine bool
+		err        error
+	}{
+		{"empty uses receive time", SkewClamp, "", now, false, nil},
+		{"in window kept", SkewClamp, "2024-06-01T11:00:00Z", now.Add(-time.Hour), false, nil},
+		{"offset kept", SkewReject, "2024-06-01T14:00:00+02:00", now, false, nil},
+		{"window edges inclusive", SkewReject, "2024-06-01T12:05:00Z", latest, false, nil},
+		{"clamp past", SkewClamp, "2024-01-01T00:00:00Z", earliest, false, nil},
+		{"clamp future", SkewClamp, "2030-01-01T00:00:00Z", latest, false, nil},
+		{"clamp unparseable", SkewClamp, "yesterday", now, false, nil},
+		{"reject past", SkewReject, "2024-01-01T00:00:00Z", time.Time{}, false, ErrTimestampSkew},
+		{"reject unparseable", SkewReject, "1717243200", time.Time{}, false, ErrTimestampSkew},
+		{"quarantine keeps ts", SkewQuarantine, "2030-01-01T00:00:00Z", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), true, nil},
+		{"quarantine unparseable", SkewQuarantine, "not a time", now, true, nil},
+		{"quarantine in window", SkewQuarantine, "2024-06-01T11:00:00Z", now.Add(-time.Hour), false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := TimestampPolicy{MaxPast: 72 * time.Hour, MaxFuture: 5 * time.Minute, Action: tt.action}
+			got, quarantine, err := p.resolve(tt.clientTS, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ts = %v, want %v", got, tt.want)
+			}
+			if quarantine != tt.quarantine {
+				t.Errorf("quarantine = %v, want %v", quarantine, tt.quarantine)
+			}
+		})
+	}
+}
+
+func TestTimestampPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"", SkewClamp},
+		{SkewReject, SkewReject},
+		{SkewQuarantine, SkewQuarantine},
+		{"drop", SkewClamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Setenv("TS_SKEW_POLICY", tt.policy)
+			if got := TimestampPolicyFromEnv().Action; got != tt.want {
+				t.Errorf("Action = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
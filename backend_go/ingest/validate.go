@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	ingestpb "bigdata-perf/proto"
+)
+
+// Limits enforced on every incoming event.
+const (
+	maxIDLen        = 64
+	maxUserIDLen    = 128
+	maxEventTypeLen = 64
+	maxURLLen       = 2048
+	maxTSLen        = 64
+	maxMetaKeys     = 50
+	maxMetaKeyLen   = 128
+	maxMetaValueLen = 1024
+	maxMetaBytes    = 8 * 1024
+)
+
+// FieldViolation describes one invalid field of an event.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ValidationError lists every invalid field of a rejected event.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.Field + ": " + v.Description
+	}
+	return "invalid event: " + strings.Join(parts, "; ")
+}
+
+// UnknownField returns the error for a field the EventRequest schema does not
+// have.
+func UnknownField(name string) error {
+	return &ValidationError{Violations: []FieldViolation{{Field: name, Description: "unknown field"}}}
+}
+
+// Violations returns the field violations behind err, or nil when err is not
+// a rejection of the event itself.
+func Violations(err error) []FieldViolation {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Violations
+	}
+	if errors.Is(err, ErrTimestampSkew) {
+		return []FieldViolation{{Field: "ts", Description: err.Error()}}
+	}
+	return nil
+}
+
+// Validate checks req against the event schema limits: required fields,
+// lengths, URL syntax and meta size. It returns a *ValidationError listing
+// every problem found.
+func Validate(req *ingestpb.EventRequest) error {
+	var v []FieldViolation
+	add := func(field, format string, args ...any) {
+		v = append(v, FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+	}
+	checkLen := func(field, value string, limit int) {
+		if !utf8.ValidString(value) {
+			add(field, "must be valid UTF-8")
+		} else if len(value) > limit {
+			add(field, "must be at most %d bytes", limit)
+		}
+	}
+	checkURL := func(field, value string) {
+		if value == "" {
+			return
+		}
+		checkLen(field, value, maxURLLen)
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(field, "must be an absolute http(s) URL")
+		}
+	}
+
+	if req.EventType == "" {
+		add("event_type", "is required")
+	}
+	checkLen("event_type", req.EventType, maxEventTypeLen)
+	checkLen("id", req.Id, maxIDLen)
+	checkLen("user_id", req.UserId, maxUserIDLen)
+	checkLen("ts", req.Ts, maxTSLen)
+	checkURL("url", req.Url)
+	checkURL("referrer", req.Referrer)
+
+	if len(req.Meta) > maxMetaKeys {
+		add("meta", "must have at most %d keys", maxMetaKeys)
+	}
+	size := 0
+	for k, val := range req.Meta {
+		size += len(k) + len(val)
+		if k == "" {
+			add("meta", "keys must not be empty")
+		}
+		checkLen("meta."+k, k, maxMetaKeyLen)
+		checkLen("meta."+k, val, maxMetaValueLen)
+	}
+	if size > maxMetaBytes {
+		add("meta", "must be at most %d bytes in total", maxMetaBytes)
+	}
+
+	if len(req.ProtoReflect().GetUnknown()) > 0 {
+		add("(unknown)", "message contains fields not in the EventRequest schema")
+	}
+
+	if len(v) > 0 {
+		return &ValidationError{Violations: v}
+	}
+	return nil
+}
@@ -28,6 +28,9 @@ var (
     runServices   bool
     httpPort      string
     grpcPort      string
+    grpcAdminPort string
+    otlpHTTPPort  string
+    consumerHealthPort string
     requiredPorts []int
 )
 
@@ -42,9 +45,27 @@ func init() {
         grpcPort = "50051"
     }
 
+    grpcAdminPort = os.Getenv("GRPC_ADMIN_PORT")
+    if grpcAdminPort == "" {
+        grpcAdminPort = "50052"
+    }
+
+    otlpHTTPPort = os.Getenv("OTLP_HTTP_PORT")
+    if otlpHTTPPort == "" {
+        otlpHTTPPort = "4318"
+    }
+
+    consumerHealthPort = os.Getenv("CONSUMER_HEALTH_PORT")
+    if consumerHealthPort == "" {
+        consumerHealthPort = "8089"
+    }
+
     requiredPorts = []int{
         parsePort(httpPort),
         parsePort(grpcPort),
+        parsePort(grpcAdminPort),
+        parsePort(otlpHTTPPort),
+        parsePort(consumerHealthPort),
     }
 }
 
@@ -109,6 +130,8 @@ func recreateTableIfConfirmed() {
                     fmt.Println("✅ Table dropped and recreated.")
                     return
                 }
+                // init.sql is idempotent, so rerun it to add any new columns.
+                execShell("clickhouse-client", "--multiquery", "--queries-file=clickhouse/init.sql")
                 fmt.Println("✅ Keeping existing table.")
                 return
 	}
@@ -117,24 +140,49 @@ func recreateTableIfConfirmed() {
 	fmt.Println("✅ Table initialized.")
 }
 
+// waitReady polls a service's /readyz until it answers 200, instead of
+// guessing with a fixed sleep. `go run` compiles first, so allow a while.
+func waitReady(name, url string) {
+	deadline := time.Now().Add(90 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				log.Printf("✅ %s is ready", name)
+				return
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	log.Printf("⚠️  %s not ready after 90s (%s)", name, url)
+}
+
 func startAllServices() {
+	// The local services run without keys unless a key file is configured.
+	if os.Getenv("API_KEYS_FILE") == "" && os.Getenv("INGEST_AUTH") == "" {
+		log.Println("🔧 API_KEYS_FILE not set, starting services with INGEST_AUTH=disabled")
+		os.Setenv("INGEST_AUTH", "disabled")
+	}
+
 	go func() {
 		log.Println("🚀 Starting HTTP Producer at :" + httpPort)
-		execShell("go", "run", "cmd/producer/main.go", fmt.Sprintf("-port=%s", httpPort))
+		execShell("go", "run", "./cmd/producer", fmt.Sprintf("-port=%s", httpPort))
 	}()
-	time.Sleep(1 * time.Second)
 
 	go func() {
 		log.Println("🚀 Starting gRPC Server at :" + grpcPort)
-		execShell("go", "run", "cmd/grpcserver/main.go", fmt.Sprintf("-port=%s", grpcPort))
+		execShell("go", "run", "./cmd/grpcserver", fmt.Sprintf("-port=%s", grpcPort), fmt.Sprintf("-admin-port=%s", grpcAdminPort), fmt.Sprintf("-otlp-http-port=%s", otlpHTTPPort))
 	}()
-	time.Sleep(1 * time.Second)
 
 	go func() {
 		log.Println("🚀 Starting RabbitMQ Consumer")
-		execShell("go", "run", "cmd/consumer/main.go")
+		execShell("go", "run", "./cmd/consumer", fmt.Sprintf("-health-port=%s", consumerHealthPort))
 	}()
-	time.Sleep(2 * time.Second)
+
+	waitReady("HTTP Producer", "http://localhost:"+httpPort+"/readyz")
+	waitReady("gRPC Server", "http://localhost:"+grpcAdminPort+"/readyz")
+	waitReady("RabbitMQ Consumer", "http://localhost:"+consumerHealthPort+"/readyz")
 }
 
 func seedTestEvents(count int) {
@@ -145,6 +193,9 @@ func seedTestEvents(count int) {
 	urls := []string{"/home", "/shop", "/about", "/search", "/article"}
 	referrers := []string{"https://google.com", "https://bing.com", "https://ads.com", "https://facebook.com"}
 
+	// Needed when the producer runs with API_KEYS_FILE.
+	apiKey := os.Getenv("INGEST_API_KEY")
+
 	batchSize := 100
 	switch {
 	case count < 500:
@@ -165,7 +216,12 @@ func seedTestEvents(count int) {
 		body, _ := json.Marshal(evt)
 
 		successCount := 0
-		resp, err := http.Post("http://localhost:"+httpPort+"/events", "application/json", bytes.NewReader(body))
+		req, _ := http.NewRequest("POST", "http://localhost:"+httpPort+"/events", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
 	        if err != nil {
 		    log.Printf("❌ [%d] Error sending to RabbitMQ producer: %v", i, err)
 	        } else {
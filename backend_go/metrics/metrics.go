@@ -0,0 +1,182 @@
+// Package metrics defines the Prometheus metrics of the whole pipeline in one
+// place, so every binary uses the same names and one dashboard covers
+// ingest, broker, consumer and API. All metrics live under the "bigdata"
+// namespace and are served on /metrics.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "bigdata"
+
+// Ingest: cmd/producer and cmd/grpcserver.
+var (
+	IngestRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingest", Name: "requests_total",
+		Help: "Ingest requests by endpoint and response code.",
+	}, []string{"endpoint", "code"})
+
+	IngestEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingest", Name: "events_total",
+		Help: "Events by endpoint and outcome (queued, quarantined, spooled, dropped, sampled_out, replayed, skipped, invalid, unavailable, error).",
+	}, []string{"endpoint", "result"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingest", Name: "rate_limited_total",
+		Help: "Requests rejected by rate limiting, by scope (global, key, ip).",
+	}, []string{"scope"})
+
+	ScrubMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingest", Name: "scrub_matches_total",
+		Help: "Values matched by PII scrub rules, whether scrubbed or only reported in dry-run mode.",
+	}, []string{"rule"})
+)
+
+// Broker: publishing to RabbitMQ.
+var (
+	PublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "broker", Name: "publish_duration_seconds",
+		Help:    "Time from publish to broker confirm.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"exchange"})
+
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "broker", Name: "publish_failures_total",
+		Help: "Publishes the broker did not confirm, by reason (nack, timeout, unavailable, unroutable).",
+	}, []string{"exchange", "reason"})
+)
+
+// Spool: events kept on local disk while the broker is down.
+var (
+	SpoolEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "spool", Name: "events",
+		Help: "Events waiting in the spool to be replayed.",
+	}, []string{"spool"})
+
+	SpoolBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "spool", Name: "bytes",
+		Help: "Size of the spool segment files.",
+	}, []string{"spool"})
+
+	SpoolReplayed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "spool", Name: "replayed_total",
+		Help: "Spooled events published to the broker.",
+	}, []string{"spool"})
+
+	SpoolDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "spool", Name: "dropped_total",
+		Help: "Events not spooled or lost from the spool, by reason (full, overflow, corrupt, unroutable).",
+	}, []string{"spool", "reason"})
+)
+
+// Consumer: RabbitMQ to ClickHouse.
+var (
+	ConsumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "consumer", Name: "messages_total",
+		Help: "Messages received from RabbitMQ.",
+	}, []string{"queue"})
+
+	ConsumerDecodeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "consumer", Name: "decode_errors_total",
+		Help: "Messages that could not be decoded as EventRequest.",
+	}, []string{"queue"})
+
+	ConsumerInsertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "consumer", Name: "insert_duration_seconds",
+		Help:    "Time to insert events into ClickHouse, per insert.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"table"})
+
+	ConsumerInsertErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "consumer", Name: "insert_errors_total",
+		Help: "Events that failed to insert into ClickHouse.",
+	}, []string{"table"})
+
+	ConsumerBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "consumer", Name: "batch_size",
+		Help:    "Events per ClickHouse insert.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"table"})
+)
+
+// API: cmd/api queries.
+var (
+	APIQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "api", Name: "query_duration_seconds",
+		Help:    "ClickHouse query time per API handler.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"handler"})
+
+	APIRowsReturned = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "api", Name: "rows_returned",
+		Help:    "Rows returned per API response.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"handler"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentHandler counts requests to h in IngestRequests and tags the
+// request context with endpoint, so the events it publishes are counted
+// under the same name.
+func InstrumentHandler(endpoint string, h http.Handler) http.Handler {
+	counter := IngestRequests.MustCurryWith(prometheus.Labels{"endpoint": endpoint})
+	return promhttp.InstrumentHandlerCounter(counter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(WithEndpoint(r.Context(), endpoint)))
+	}))
+}
+
+type endpointKey struct{}
+
+// WithEndpoint returns ctx tagged with the ingest endpoint serving it.
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// Endpoint returns the ingest endpoint ctx was tagged with, or "unknown".
+func Endpoint(ctx context.Context) string {
+	if e, ok := ctx.Value(endpointKey{}).(string); ok {
+		return e
+	}
+	return "unknown"
+}
+
+// UnaryServerInterceptor is the gRPC counterpart of InstrumentHandler, using
+// the full method name as the endpoint and the status code name as the code.
+// Chain it first so calls rejected by auth or rate limiting are counted too.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(WithEndpoint(ctx, info.FullMethod), req)
+		IngestRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// serverStream is a grpc.ServerStream with a replaced context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls,
+// counted once when the stream ends.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, &serverStream{ss, WithEndpoint(ss.Context(), info.FullMethod)})
+		IngestRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return err
+	}
+}
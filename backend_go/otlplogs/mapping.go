@@ -0,0 +1,241 @@
+// Package otlplogs receives OpenTelemetry logs over OTLP (gRPC and HTTP) and
+// publishes the log records that describe product events to the ingest
+// pipeline.
+package otlplogs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"strconv"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"bigdata-perf/clientinfo"
+	"bigdata-perf/config"
+	ingestpb "bigdata-perf/proto"
+)
+
+// Attributes read from every record besides the mapping, following the
+// OpenTelemetry semantic conventions.
+const (
+	attrServiceName   = "service.name"
+	attrClientAddress = "client.address"
+	attrUserAgent     = "user_agent.original"
+)
+
+// Mapping names the log record attributes the event fields are read from.
+// Each field takes the first attribute of its list that is set; the
+// attributes used are left out of meta.
+type Mapping struct {
+	EventType []string
+	UserID    []string
+	URL       []string
+}
+
+// MappingFromEnv reads the mapping from OTLP_EVENT_TYPE_ATTRS,
+// OTLP_USER_ID_ATTRS and OTLP_URL_ATTRS, comma-separated attribute names.
+func MappingFromEnv() Mapping {
+	return Mapping{
+		EventType: config.List("OTLP_EVENT_TYPE_ATTRS", []string{"event.name", "event_type"}),
+		UserID:    config.List("OTLP_USER_ID_ATTRS", []string{"user.id", "enduser.id", "user_id"}),
+		URL:       config.List("OTLP_URL_ATTRS", []string{"url.full", "http.url", "url"}),
+	}
+}
+
+// record is an event read from a log record, with the end user's client
+// when the record names it.
+type record struct {
+	req       *ingestpb.EventRequest
+	clientIP  netip.Addr
+	userAgent string
+}
+
+// context returns ctx with the client of r in place of the exporter's.
+func (r record) context(ctx context.Context) context.Context {
+	if !r.clientIP.IsValid() && r.userAgent == "" {
+		return ctx
+	}
+	info, _ := clientinfo.FromContext(ctx)
+	if r.clientIP.IsValid() {
+		info.IP = r.clientIP
+	}
+	if r.userAgent != "" {
+		info.UserAgent = r.userAgent
+	}
+	return clientinfo.NewContext(ctx, info)
+}
+
+// records returns the events in logs, and how many records were skipped for
+// having no event type: ordinary log lines rather than events.
+func (m Mapping) records(logs []*logspb.ResourceLogs) ([]record, int) {
+	var records []record
+	skipped := 0
+	for _, rl := range logs {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				r, ok := m.record(rl.GetResource(), lr)
+				if !ok {
+					skipped++
+					continue
+				}
+				records = append(records, r)
+			}
+		}
+	}
+	return records, skipped
+}
+
+// record maps one log record. The event type falls back to the record's
+// event_name, and client.address and user_agent.original stand in for the
+// exporter's address and User-Agent in enrichment. The remaining attributes
+// go into meta, with nested lists flattened to dotted keys, along with
+// service.name and a string body. The id is a hash of the record, so a batch
+// the exporter retries keeps its ids and ClickHouse collapses the duplicates.
+func (m Mapping) record(res *resourcepb.Resource, lr *logspb.LogRecord) (record, bool) {
+	attrs := make(map[string]*commonpb.AnyValue, len(lr.GetAttributes()))
+	for _, kv := range lr.GetAttributes() {
+		attrs[kv.GetKey()] = kv.GetValue()
+	}
+	take := func(keys []string) string {
+		for _, k := range keys {
+			if v, ok := attrs[k]; ok {
+				if s := valueString(v); s != "" {
+					delete(attrs, k)
+					return s
+				}
+			}
+		}
+		return ""
+	}
+
+	req := &ingestpb.EventRequest{
+		EventType: take(m.EventType),
+		UserId:    take(m.UserID),
+		Url:       take(m.URL),
+	}
+	if req.EventType == "" {
+		req.EventType = lr.GetEventName()
+	}
+	if req.EventType == "" {
+		return record{}, false
+	}
+
+	r := record{
+		clientIP:  clientinfo.ParseHost(take([]string{attrClientAddress})),
+		userAgent: take([]string{attrUserAgent}),
+	}
+
+	ts := lr.GetTimeUnixNano()
+	if ts == 0 {
+		ts = lr.GetObservedTimeUnixNano()
+	}
+	if ts != 0 {
+		req.Ts = time.Unix(0, int64(ts)).UTC().Format(time.RFC3339)
+	}
+
+	meta := map[string]string{}
+	for k, v := range attrs {
+		flatten(meta, k, v)
+	}
+	for _, kv := range res.GetAttributes() {
+		if kv.GetKey() == attrServiceName {
+			if _, ok := meta[attrServiceName]; !ok {
+				meta[attrServiceName] = valueString(kv.GetValue())
+			}
+		}
+	}
+	if body := lr.GetBody().GetStringValue(); body != "" {
+		if _, ok := meta["body"]; !ok {
+			meta["body"] = body
+		}
+	}
+	if len(meta) > 0 {
+		req.Meta = meta
+	}
+
+	req.Id = recordID(res, lr)
+	r.req = req
+	return r, true
+}
+
+// recordID hashes the record and its resource into an event id.
+func recordID(res *resourcepb.Resource, lr *logspb.LogRecord) string {
+	opts := proto.MarshalOptions{Deterministic: true}
+	h := sha256.New()
+	data, _ := opts.Marshal(res)
+	h.Write(data)
+	data, _ = opts.Marshal(lr)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// flatten stores v in meta under key, joining the keys of nested key-value
+// lists with dots. Arrays are stored as JSON.
+func flatten(meta map[string]string, key string, v *commonpb.AnyValue) {
+	if kvs, ok := v.GetValue().(*commonpb.AnyValue_KvlistValue); ok {
+		for _, kv := range kvs.KvlistValue.GetValues() {
+			flatten(meta, key+"."+kv.GetKey(), kv.GetValue())
+		}
+		return
+	}
+	if v.GetValue() != nil {
+		meta[key] = valueString(v)
+	}
+}
+
+// valueString renders an attribute value as a meta value.
+func valueString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		data, _ := json.Marshal(plain(&commonpb.AnyValue{Value: v}))
+		return string(data)
+	}
+	return ""
+}
+
+// plain converts v to the Go value encoding/json renders it as.
+func plain(v *commonpb.AnyValue) any {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, len(v.ArrayValue.GetValues()))
+		for i, item := range v.ArrayValue.GetValues() {
+			values[i] = plain(item)
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		obj := make(map[string]any, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			obj[kv.GetKey()] = plain(kv.GetValue())
+		}
+		return obj
+	}
+	return nil
+}
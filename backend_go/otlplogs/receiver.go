@@ -0,0 +1,206 @@
+package otlplogs
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"bigdata-perf/broker"
+	"bigdata-perf/ingest"
+	"bigdata-perf/metrics"
+	"bigdata-perf/ratelimit"
+)
+
+// HTTPPath is where OTLP/HTTP exporters send logs.
+const HTTPPath = "/v1/logs"
+
+// maxBodyBytes caps an OTLP/HTTP body, both as sent and decompressed.
+const maxBodyBytes = 8 << 20
+
+// Receiver publishes OTLP log exports through the ingest pipeline. It serves
+// the OTLP/gRPC LogsService and, as an http.Handler, OTLP/HTTP.
+type Receiver struct {
+	collogspb.UnimplementedLogsServiceServer
+	pipeline *ingest.Pipeline
+	mapping  Mapping
+}
+
+func NewReceiver(pipeline *ingest.Pipeline, mapping Mapping) *Receiver {
+	return &Receiver{pipeline: pipeline, mapping: mapping}
+}
+
+// export publishes records, the events of an export request, sending them
+// all before waiting for the confirms as /events/batch does. Records the
+// pipeline refuses are reported as a partial success. A broker outage fails
+// the whole export so the exporter retries it; the records already published
+// keep their ids on the retry, so ClickHouse collapses them.
+func (r *Receiver) export(ctx context.Context, records []record, skipped int) (*collogspb.ExportLogsServiceResponse, error) {
+	if skipped > 0 {
+		metrics.IngestEvents.WithLabelValues(metrics.Endpoint(ctx), "skipped").Add(float64(skipped))
+	}
+
+	var rejected int64
+	var rejectMsg string
+	var unavailable error
+	fail := func(err error) {
+		if broker.IsRetryable(err) {
+			unavailable = err
+			return
+		}
+		rejected++
+		if rejectMsg == "" {
+			rejectMsg = err.Error()
+		}
+	}
+
+	receipts := make([]*ingest.Receipt, 0, len(records))
+	for _, rec := range records {
+		receipt, err := r.pipeline.Send(rec.context(ctx), rec.req)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		receipts = append(receipts, receipt)
+	}
+	for _, receipt := range receipts {
+		if err := r.pipeline.Await(ctx, receipt); err != nil {
+			fail(err)
+		}
+	}
+
+	if unavailable != nil {
+		return nil, unavailable
+	}
+	log.Printf("✅ OTLP export: %d events published, %d rejected, %d log records skipped", len(receipts), rejected, skipped)
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       rejectMsg,
+		}
+	}
+	return resp, nil
+}
+
+// Export implements the OTLP/gRPC LogsService. Like a batch, an export is
+// rate limited per event.
+func (r *Receiver) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	records, skipped := r.mapping.records(req.GetResourceLogs())
+	if err := ratelimit.ChargeGRPC(ctx, len(records)-1); err != nil {
+		return nil, err
+	}
+	resp, err := r.export(ctx, records, skipped)
+	switch {
+	case err == nil:
+		return resp, nil
+	case broker.IsRetryable(err):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+}
+
+// ServeHTTP implements OTLP/HTTP: a protobuf or JSON export request, possibly
+// gzipped, answered in the same encoding. Failures are answered with a
+// google.rpc.Status body, with 429 or 503 for the ones worth retrying.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var unmarshal func([]byte, proto.Message) error
+	var marshal func(proto.Message) ([]byte, error)
+	switch mt {
+	case "application/x-protobuf":
+		unmarshal, marshal = proto.Unmarshal, proto.Marshal
+	case "application/json":
+		unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal
+		marshal = protojson.Marshal
+	default:
+		w.Header().Set("Accept", "application/x-protobuf, application/json")
+		http.Error(w, "unsupported Content-Type, expected application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	writeStatus := func(code int, c codes.Code, msg string) {
+		data, _ := marshal(&spb.Status{Code: int32(c), Message: msg})
+		w.Header().Set("Content-Type", mt)
+		w.WriteHeader(code)
+		w.Write(data)
+	}
+
+	body, err := readBody(w, req)
+	if err != nil {
+		log.Printf("❌ OTLP body: %v", err)
+		writeStatus(http.StatusBadRequest, codes.InvalidArgument, err.Error())
+		return
+	}
+	var export collogspb.ExportLogsServiceRequest
+	if err := unmarshal(body, &export); err != nil {
+		writeStatus(http.StatusBadRequest, codes.InvalidArgument, fmt.Sprintf("invalid export request: %v", err))
+		return
+	}
+
+	records, skipped := r.mapping.records(export.GetResourceLogs())
+	if ok, wait := ratelimit.Charge(req.Context(), len(records)-1); !ok {
+		w.Header().Set("Retry-After", ratelimit.RetryAfter(wait))
+		writeStatus(http.StatusTooManyRequests, codes.ResourceExhausted, "rate limit exceeded")
+		return
+	}
+	resp, err := r.export(req.Context(), records, skipped)
+	if err != nil {
+		log.Printf("❌ OTLP export failed: %v", err)
+		if broker.IsRetryable(err) {
+			w.Header().Set("Retry-After", "1")
+			writeStatus(http.StatusServiceUnavailable, codes.Unavailable, err.Error())
+		} else {
+			writeStatus(http.StatusInternalServerError, codes.Internal, err.Error())
+		}
+		return
+	}
+	data, err := marshal(resp)
+	if err != nil {
+		writeStatus(http.StatusInternalServerError, codes.Internal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", mt)
+	w.Write(data)
+}
+
+// readBody returns the request body, gunzipped when the exporter compressed
+// it.
+func readBody(w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, req.Body, maxBodyBytes)
+	switch enc := req.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxBodyBytes+1))
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) || len(data) > maxBodyBytes {
+		return nil, fmt.Errorf("request body larger than %d bytes", maxBodyBytes)
+	}
+	return data, err
+}
@@ -22,14 +22,37 @@ const (
 )
 
 type EventRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	EventType     string                 `protobuf:"bytes,3,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
-	Url           string                 `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
-	Referrer      string                 `protobuf:"bytes,5,opt,name=referrer,proto3" json:"referrer,omitempty"`
-	Ts            string                 `protobuf:"bytes,6,opt,name=ts,proto3" json:"ts,omitempty"`
-	Meta          map[string]string      `protobuf:"bytes,7,rep,name=meta,proto3" json:"meta,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId    string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	EventType string                 `protobuf:"bytes,3,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	Url       string                 `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
+	Referrer  string                 `protobuf:"bytes,5,opt,name=referrer,proto3" json:"referrer,omitempty"`
+	Ts        string                 `protobuf:"bytes,6,opt,name=ts,proto3" json:"ts,omitempty"`
+	Meta      map[string]string      `protobuf:"bytes,7,rep,name=meta,proto3" json:"meta,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Server receive time (RFC3339), set at ingest. ts keeps the client time.
+	ReceivedAt string `protobuf:"bytes,8,opt,name=received_at,json=receivedAt,proto3" json:"received_at,omitempty"`
+	// Project of the write key the event was sent with, set at ingest.
+	Project string `protobuf:"bytes,9,opt,name=project,proto3" json:"project,omitempty"`
+	// Client details captured at ingest from the connection and User-Agent
+	// header. client_ip may be truncated for privacy.
+	ClientIp       string `protobuf:"bytes,10,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	UserAgent      string `protobuf:"bytes,11,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Browser        string `protobuf:"bytes,12,opt,name=browser,proto3" json:"browser,omitempty"`
+	BrowserVersion string `protobuf:"bytes,13,opt,name=browser_version,json=browserVersion,proto3" json:"browser_version,omitempty"`
+	Os             string `protobuf:"bytes,14,opt,name=os,proto3" json:"os,omitempty"`
+	OsVersion      string `protobuf:"bytes,15,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
+	// One of desktop, mobile, tablet, bot, or empty when unknown.
+	DeviceType string `protobuf:"bytes,16,opt,name=device_type,json=deviceType,proto3" json:"device_type,omitempty"`
+	// Location of client_ip from the GeoIP database, looked up at ingest
+	// before any truncation. country is an ISO 3166-1 alpha-2 code.
+	Country string `protobuf:"bytes,17,opt,name=country,proto3" json:"country,omitempty"`
+	Region  string `protobuf:"bytes,18,opt,name=region,proto3" json:"region,omitempty"`
+	City    string `protobuf:"bytes,19,opt,name=city,proto3" json:"city,omitempty"`
+	// Fraction of users whose events of this kind are kept, set at ingest by
+	// the sampling rules; 1 when unsampled. Each stored event stands for
+	// 1 / sample_rate events.
+	SampleRate    float64 `protobuf:"fixed64,20,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -113,6 +136,97 @@ func (x *EventRequest) GetMeta() map[string]string {
 	return nil
 }
 
+func (x *EventRequest) GetReceivedAt() string {
+	if x != nil {
+		return x.ReceivedAt
+	}
+	return ""
+}
+
+func (x *EventRequest) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *EventRequest) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+func (x *EventRequest) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *EventRequest) GetBrowser() string {
+	if x != nil {
+		return x.Browser
+	}
+	return ""
+}
+
+func (x *EventRequest) GetBrowserVersion() string {
+	if x != nil {
+		return x.BrowserVersion
+	}
+	return ""
+}
+
+func (x *EventRequest) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *EventRequest) GetOsVersion() string {
+	if x != nil {
+		return x.OsVersion
+	}
+	return ""
+}
+
+func (x *EventRequest) GetDeviceType() string {
+	if x != nil {
+		return x.DeviceType
+	}
+	return ""
+}
+
+func (x *EventRequest) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *EventRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *EventRequest) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *EventRequest) GetSampleRate() float64 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
 type EventResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
@@ -165,11 +279,330 @@ func (x *EventResponse) GetId() string {
 	return ""
 }
 
+// EventBatch is the request of PublishBatch, up to 1000 events.
+type EventBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*EventRequest        `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventBatch) Reset() {
+	*x = EventBatch{}
+	mi := &file_proto_event_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventBatch) ProtoMessage() {}
+
+func (x *EventBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventBatch.ProtoReflect.Descriptor instead.
+func (*EventBatch) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EventBatch) GetEvents() []*EventRequest {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+// FieldViolation names an invalid field of an event and what is wrong with
+// it.
+type FieldViolation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FieldViolation) Reset() {
+	*x = FieldViolation{}
+	mi := &file_proto_event_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldViolation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldViolation) ProtoMessage() {}
+
+func (x *FieldViolation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldViolation.ProtoReflect.Descriptor instead.
+func (*FieldViolation) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FieldViolation) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *FieldViolation) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+// EventResult is the outcome of one event of a batch or stream: index is its
+// position, status an EventResponse status, or "rejected" with the reason.
+// replayed is set when an event with the same id was already accepted within
+// the idempotency window, and the result is that event's.
+type EventResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int64                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Violations    []*FieldViolation      `protobuf:"bytes,5,rep,name=violations,proto3" json:"violations,omitempty"`
+	Replayed      bool                   `protobuf:"varint,6,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventResult) Reset() {
+	*x = EventResult{}
+	mi := &file_proto_event_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventResult) ProtoMessage() {}
+
+func (x *EventResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventResult.ProtoReflect.Descriptor instead.
+func (*EventResult) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EventResult) GetIndex() int64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *EventResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *EventResult) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *EventResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *EventResult) GetViolations() []*FieldViolation {
+	if x != nil {
+		return x.Violations
+	}
+	return nil
+}
+
+func (x *EventResult) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      int32                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected      int32                  `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	Results       []*EventResult         `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_proto_event_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchResponse) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *BatchResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *BatchResponse) GetResults() []*EventResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// PublishSummary answers PublishEvents once the client closes the stream.
+// Only rejected events are listed, up to the first 1000, since a stream can
+// be arbitrarily long. replayed counts the accepted events that were not
+// published again because their id was already accepted.
+type PublishSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      int64                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected      int64                  `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	Rejections    []*EventResult         `protobuf:"bytes,3,rep,name=rejections,proto3" json:"rejections,omitempty"`
+	Replayed      int64                  `protobuf:"varint,4,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishSummary) Reset() {
+	*x = PublishSummary{}
+	mi := &file_proto_event_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishSummary) ProtoMessage() {}
+
+func (x *PublishSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishSummary.ProtoReflect.Descriptor instead.
+func (*PublishSummary) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PublishSummary) GetAccepted() int64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *PublishSummary) GetRejected() int64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *PublishSummary) GetRejections() []*EventResult {
+	if x != nil {
+		return x.Rejections
+	}
+	return nil
+}
+
+func (x *PublishSummary) GetReplayed() int64 {
+	if x != nil {
+		return x.Replayed
+	}
+	return 0
+}
+
 var File_proto_event_proto protoreflect.FileDescriptor
 
 const file_proto_event_proto_rawDesc = "" +
 	"\n" +
-	"\x11proto/event.proto\x12\x06ingest\"\x81\x02\n" +
+	"\x11proto/event.proto\x12\x06ingest\"\xf2\x04\n" +
 	"\fEventRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1d\n" +
@@ -178,15 +611,62 @@ const file_proto_event_proto_rawDesc = "" +
 	"\x03url\x18\x04 \x01(\tR\x03url\x12\x1a\n" +
 	"\breferrer\x18\x05 \x01(\tR\breferrer\x12\x0e\n" +
 	"\x02ts\x18\x06 \x01(\tR\x02ts\x122\n" +
-	"\x04meta\x18\a \x03(\v2\x1e.ingest.EventRequest.MetaEntryR\x04meta\x1a7\n" +
+	"\x04meta\x18\a \x03(\v2\x1e.ingest.EventRequest.MetaEntryR\x04meta\x12\x1f\n" +
+	"\vreceived_at\x18\b \x01(\tR\n" +
+	"receivedAt\x12\x18\n" +
+	"\aproject\x18\t \x01(\tR\aproject\x12\x1b\n" +
+	"\tclient_ip\x18\n" +
+	" \x01(\tR\bclientIp\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\v \x01(\tR\tuserAgent\x12\x18\n" +
+	"\abrowser\x18\f \x01(\tR\abrowser\x12'\n" +
+	"\x0fbrowser_version\x18\r \x01(\tR\x0ebrowserVersion\x12\x0e\n" +
+	"\x02os\x18\x0e \x01(\tR\x02os\x12\x1d\n" +
+	"\n" +
+	"os_version\x18\x0f \x01(\tR\tosVersion\x12\x1f\n" +
+	"\vdevice_type\x18\x10 \x01(\tR\n" +
+	"deviceType\x12\x18\n" +
+	"\acountry\x18\x11 \x01(\tR\acountry\x12\x16\n" +
+	"\x06region\x18\x12 \x01(\tR\x06region\x12\x12\n" +
+	"\x04city\x18\x13 \x01(\tR\x04city\x12\x1f\n" +
+	"\vsample_rate\x18\x14 \x01(\x01R\n" +
+	"sampleRate\x1a7\n" +
 	"\tMetaEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"7\n" +
 	"\rEventResponse\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\tR\x06status\x12\x0e\n" +
-	"\x02id\x18\x02 \x01(\tR\x02id2K\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\":\n" +
+	"\n" +
+	"EventBatch\x12,\n" +
+	"\x06events\x18\x01 \x03(\v2\x14.ingest.EventRequestR\x06events\"H\n" +
+	"\x0eFieldViolation\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\"\xb7\x01\n" +
+	"\vEventResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x03R\x05index\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x126\n" +
+	"\n" +
+	"violations\x18\x05 \x03(\v2\x16.ingest.FieldViolationR\n" +
+	"violations\x12\x1a\n" +
+	"\breplayed\x18\x06 \x01(\bR\breplayed\"v\n" +
+	"\rBatchResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x05R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x05R\brejected\x12-\n" +
+	"\aresults\x18\x03 \x03(\v2\x13.ingest.EventResultR\aresults\"\x99\x01\n" +
+	"\x0ePublishSummary\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x03R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x03R\brejected\x123\n" +
+	"\n" +
+	"rejections\x18\x03 \x03(\v2\x13.ingest.EventResultR\n" +
+	"rejections\x12\x1a\n" +
+	"\breplayed\x18\x04 \x01(\x03R\breplayed2\xc7\x01\n" +
 	"\fEventService\x12;\n" +
-	"\fPublishEvent\x12\x14.ingest.EventRequest\x1a\x15.ingest.EventResponseB\x1dZ\x1bbigdata-perf/proto;ingestpbb\x06proto3"
+	"\fPublishEvent\x12\x14.ingest.EventRequest\x1a\x15.ingest.EventResponse\x12?\n" +
+	"\rPublishEvents\x12\x14.ingest.EventRequest\x1a\x16.ingest.PublishSummary(\x01\x129\n" +
+	"\fPublishBatch\x12\x12.ingest.EventBatch\x1a\x15.ingest.BatchResponseB\x1dZ\x1bbigdata-perf/proto;ingestpbb\x06proto3"
 
 var (
 	file_proto_event_proto_rawDescOnce sync.Once
@@ -200,21 +680,34 @@ func file_proto_event_proto_rawDescGZIP() []byte {
 	return file_proto_event_proto_rawDescData
 }
 
-var file_proto_event_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_event_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_proto_event_proto_goTypes = []any{
-	(*EventRequest)(nil),  // 0: ingest.EventRequest
-	(*EventResponse)(nil), // 1: ingest.EventResponse
-	nil,                   // 2: ingest.EventRequest.MetaEntry
+	(*EventRequest)(nil),   // 0: ingest.EventRequest
+	(*EventResponse)(nil),  // 1: ingest.EventResponse
+	(*EventBatch)(nil),     // 2: ingest.EventBatch
+	(*FieldViolation)(nil), // 3: ingest.FieldViolation
+	(*EventResult)(nil),    // 4: ingest.EventResult
+	(*BatchResponse)(nil),  // 5: ingest.BatchResponse
+	(*PublishSummary)(nil), // 6: ingest.PublishSummary
+	nil,                    // 7: ingest.EventRequest.MetaEntry
 }
 var file_proto_event_proto_depIdxs = []int32{
-	2, // 0: ingest.EventRequest.meta:type_name -> ingest.EventRequest.MetaEntry
-	0, // 1: ingest.EventService.PublishEvent:input_type -> ingest.EventRequest
-	1, // 2: ingest.EventService.PublishEvent:output_type -> ingest.EventResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	7, // 0: ingest.EventRequest.meta:type_name -> ingest.EventRequest.MetaEntry
+	0, // 1: ingest.EventBatch.events:type_name -> ingest.EventRequest
+	3, // 2: ingest.EventResult.violations:type_name -> ingest.FieldViolation
+	4, // 3: ingest.BatchResponse.results:type_name -> ingest.EventResult
+	4, // 4: ingest.PublishSummary.rejections:type_name -> ingest.EventResult
+	0, // 5: ingest.EventService.PublishEvent:input_type -> ingest.EventRequest
+	0, // 6: ingest.EventService.PublishEvents:input_type -> ingest.EventRequest
+	2, // 7: ingest.EventService.PublishBatch:input_type -> ingest.EventBatch
+	1, // 8: ingest.EventService.PublishEvent:output_type -> ingest.EventResponse
+	6, // 9: ingest.EventService.PublishEvents:output_type -> ingest.PublishSummary
+	5, // 10: ingest.EventService.PublishBatch:output_type -> ingest.BatchResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_event_proto_init() }
@@ -228,7 +721,7 @@ func file_proto_event_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_event_proto_rawDesc), len(file_proto_event_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
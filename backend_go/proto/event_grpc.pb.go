@@ -19,7 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	EventService_PublishEvent_FullMethodName = "/ingest.EventService/PublishEvent"
+	EventService_PublishEvent_FullMethodName  = "/ingest.EventService/PublishEvent"
+	EventService_PublishEvents_FullMethodName = "/ingest.EventService/PublishEvents"
+	EventService_PublishBatch_FullMethodName  = "/ingest.EventService/PublishBatch"
 )
 
 // EventServiceClient is the client API for EventService service.
@@ -27,6 +29,12 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type EventServiceClient interface {
 	PublishEvent(ctx context.Context, in *EventRequest, opts ...grpc.CallOption) (*EventResponse, error)
+	// PublishEvents publishes a stream of events. The server reads ahead of
+	// broker confirms by a bounded window, so a slow broker slows the stream
+	// down through flow control.
+	PublishEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EventRequest, PublishSummary], error)
+	// PublishBatch publishes a batch of events with a result per event.
+	PublishBatch(ctx context.Context, in *EventBatch, opts ...grpc.CallOption) (*BatchResponse, error)
 }
 
 type eventServiceClient struct {
@@ -47,11 +55,40 @@ func (c *eventServiceClient) PublishEvent(ctx context.Context, in *EventRequest,
 	return out, nil
 }
 
+func (c *eventServiceClient) PublishEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EventRequest, PublishSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventService_ServiceDesc.Streams[0], EventService_PublishEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EventRequest, PublishSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventService_PublishEventsClient = grpc.ClientStreamingClient[EventRequest, PublishSummary]
+
+func (c *eventServiceClient) PublishBatch(ctx context.Context, in *EventBatch, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, EventService_PublishBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EventServiceServer is the server API for EventService service.
 // All implementations must embed UnimplementedEventServiceServer
 // for forward compatibility.
 type EventServiceServer interface {
 	PublishEvent(context.Context, *EventRequest) (*EventResponse, error)
+	// PublishEvents publishes a stream of events. The server reads ahead of
+	// broker confirms by a bounded window, so a slow broker slows the stream
+	// down through flow control.
+	PublishEvents(grpc.ClientStreamingServer[EventRequest, PublishSummary]) error
+	// PublishBatch publishes a batch of events with a result per event.
+	PublishBatch(context.Context, *EventBatch) (*BatchResponse, error)
 	mustEmbedUnimplementedEventServiceServer()
 }
 
@@ -65,6 +102,12 @@ type UnimplementedEventServiceServer struct{}
 func (UnimplementedEventServiceServer) PublishEvent(context.Context, *EventRequest) (*EventResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PublishEvent not implemented")
 }
+func (UnimplementedEventServiceServer) PublishEvents(grpc.ClientStreamingServer[EventRequest, PublishSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method PublishEvents not implemented")
+}
+func (UnimplementedEventServiceServer) PublishBatch(context.Context, *EventBatch) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishBatch not implemented")
+}
 func (UnimplementedEventServiceServer) mustEmbedUnimplementedEventServiceServer() {}
 func (UnimplementedEventServiceServer) testEmbeddedByValue()                      {}
 
@@ -104,6 +147,31 @@ func _EventService_PublishEvent_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EventService_PublishEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventServiceServer).PublishEvents(&grpc.GenericServerStream[EventRequest, PublishSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventService_PublishEventsServer = grpc.ClientStreamingServer[EventRequest, PublishSummary]
+
+func _EventService_PublishBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EventBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventServiceServer).PublishBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventService_PublishBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventServiceServer).PublishBatch(ctx, req.(*EventBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // EventService_ServiceDesc is the grpc.ServiceDesc for EventService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,7 +183,17 @@ var EventService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PublishEvent",
 			Handler:    _EventService_PublishEvent_Handler,
 		},
+		{
+			MethodName: "PublishBatch",
+			Handler:    _EventService_PublishBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PublishEvents",
+			Handler:       _EventService_PublishEvents_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/event.proto",
 }
@@ -0,0 +1,166 @@
+// Package ratelimit throttles ingest requests with token buckets kept
+// globally, per write key and per source IP.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"bigdata-perf/config"
+	"bigdata-perf/metrics"
+)
+
+// idleTTL is how long an unused per-key or per-IP bucket is kept.
+const idleTTL = 10 * time.Minute
+
+// Limit is a token-bucket rate: RPS tokens per second, up to Burst at once.
+// A zero RPS means unlimited.
+type Limit struct {
+	RPS   float64
+	Burst int
+}
+
+func limitFromEnv(prefix string) Limit {
+	l := Limit{
+		RPS:   config.Float(prefix+"_RPS", 0),
+		Burst: config.Int(prefix+"_BURST", 0),
+	}
+	if l.Burst <= 0 {
+		l.Burst = max(1, int(l.RPS))
+	}
+	return l
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter enforces the global, per-key and per-IP limits.
+type Limiter struct {
+	global *rate.Limiter
+	perKey Limit
+	perIP  Limit
+
+	mu   sync.Mutex
+	keys map[string]*bucket
+	ips  map[string]*bucket
+}
+
+// FromEnv builds a Limiter from RATE_LIMIT_{GLOBAL,KEY,IP}_{RPS,BURST}.
+func FromEnv() *Limiter {
+	l := &Limiter{
+		perKey: limitFromEnv("RATE_LIMIT_KEY"),
+		perIP:  limitFromEnv("RATE_LIMIT_IP"),
+		keys:   map[string]*bucket{},
+		ips:    map[string]*bucket{},
+	}
+	if g := limitFromEnv("RATE_LIMIT_GLOBAL"); g.RPS > 0 {
+		l.global = rate.NewLimiter(rate.Limit(g.RPS), g.Burst)
+	}
+	go l.sweep()
+	return l
+}
+
+// Allow takes a token from every bucket that applies to the request. key may
+// be empty when authentication is disabled; keyLimit overrides the default
+// per-key limit when its RPS is set. When the request is throttled it
+// returns false and how long the client should wait.
+func (l *Limiter) Allow(ip, key string, keyLimit Limit) (bool, time.Duration) {
+	return l.AllowN(ip, key, keyLimit, 1)
+}
+
+// AllowN takes n tokens from every bucket that applies, or none: the tokens
+// are reserved in all buckets first and given back if any of them is short,
+// so a refused request costs nothing. A batch larger than a bucket's burst is
+// let through once the bucket is full and charged in full, leaving the
+// bucket in debt: later requests wait until the excess has refilled, so the
+// configured rate holds for batches of any size.
+func (l *Limiter) AllowN(ip, key string, keyLimit Limit, n int) (bool, time.Duration) {
+	return l.allowN(ip, key, keyLimit, n, 0)
+}
+
+// allowN is AllowN for a request that already took paid tokens, which count
+// towards the full bucket a batch larger than the burst waits for.
+func (l *Limiter) allowN(ip, key string, keyLimit Limit, n, paid int) (bool, time.Duration) {
+	if n <= 0 {
+		return true, 0
+	}
+	scopes := []struct {
+		name string
+		lim  *rate.Limiter
+	}{{name: "ip"}, {name: "key"}, {name: "global", lim: l.global}}
+	if ip != "" {
+		scopes[0].lim = l.bucket(l.ips, ip, l.perIP)
+	}
+	if key != "" {
+		if keyLimit.RPS <= 0 {
+			keyLimit = l.perKey
+		}
+		scopes[1].lim = l.bucket(l.keys, key, keyLimit)
+	}
+
+	now := time.Now()
+	var reserved []*rate.Reservation
+	for _, scope := range scopes {
+		if scope.lim == nil {
+			continue
+		}
+		burst := scope.lim.Burst()
+		first := min(n, max(burst-paid, 0))
+		r := scope.lim.ReserveN(now, first)
+		reserved = append(reserved, r)
+		if d := r.DelayFrom(now); !r.OK() || d > 0 {
+			// Cancel latest first so each cancellation sees the tokens
+			// of the ones after it already returned.
+			for i := len(reserved) - 1; i >= 0; i-- {
+				reserved[i].CancelAt(now)
+			}
+			metrics.RateLimited.WithLabelValues(scope.name).Inc()
+			return false, d
+		}
+		// rate.Limiter refuses to reserve more than its burst at once,
+		// so the excess is taken in burst-sized reservations.
+		for rest := n - first; rest > 0; rest -= burst {
+			reserved = append(reserved, scope.lim.ReserveN(now, min(rest, burst)))
+		}
+	}
+	return true, 0
+}
+
+// bucket returns the limiter for id, creating it with lim on first use. It
+// returns nil when lim is unlimited.
+func (l *Limiter) bucket(buckets map[string]*bucket, id string, lim Limit) *rate.Limiter {
+	if lim.RPS <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := buckets[id]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(lim.RPS), lim.Burst)}
+		buckets[id] = b
+	} else if b.limiter.Limit() != rate.Limit(lim.RPS) || b.limiter.Burst() != lim.Burst {
+		// The key file was reloaded with a new limit for this key.
+		b.limiter.SetLimit(rate.Limit(lim.RPS))
+		b.limiter.SetBurst(lim.Burst)
+	}
+	b.lastSeen = time.Now()
+	return b.limiter
+}
+
+func (l *Limiter) sweep() {
+	for now := range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for _, buckets := range []map[string]*bucket{l.keys, l.ips} {
+			for id, b := range buckets {
+				if now.Sub(b.lastSeen) > idleTTL {
+					delete(buckets, id)
+				}
+			}
+		}
+		l.mu.Unlock()
+	}
+}
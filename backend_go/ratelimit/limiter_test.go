@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func newTestLimiter(perKey Limit, global *rate.Limiter) *Limiter {
+	return &Limiter{global: global, perKey: perKey, keys: map[string]*bucket{}, ips: map[string]*bucket{}}
+}
+
+// keyTokens returns the tokens left in the bucket of key, negative when the
+// bucket is in debt.
+func keyTokens(l *Limiter, key string) float64 {
+	return l.keys[key].limiter.Tokens()
+}
+
+func TestAllowNChargesEveryEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		burst int
+		n     int
+		paid  int
+		want  float64 // tokens left in the key bucket
+	}{
+		{"single event", 10, 1, 0, 9},
+		{"batch within burst", 10, 10, 0, 0},
+		{"batch over burst goes into debt", 10, 1000, 0, -990},
+		{"charge after the request token", 10, 999, 1, -990},
+		{"burst of one", 1, 5, 0, -4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLimiter(Limit{RPS: 10, Burst: tt.burst}, nil)
+			if tt.paid > 0 {
+				if ok, _ := l.AllowN("", "k", Limit{}, tt.paid); !ok {
+					t.Fatal("request token refused")
+				}
+			}
+			ok, wait := l.allowN("", "k", Limit{}, tt.n, tt.paid)
+			if !ok {
+				t.Fatalf("batch of %d refused, wait %v", tt.n, wait)
+			}
+			if got := keyTokens(l, "k"); math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("%v tokens left, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowNHoldsRateForLargeBatches(t *testing.T) {
+	l := newTestLimiter(Limit{RPS: 10, Burst: 10}, nil)
+	if ok, _ := l.AllowN("", "k", Limit{}, 1000); !ok {
+		t.Fatal("first batch refused on a full bucket")
+	}
+	ok, wait := l.AllowN("", "k", Limit{}, 1000)
+	if ok {
+		t.Fatal("second batch admitted while the first is still being paid off")
+	}
+	// 990 tokens of debt plus a full burst, at 10 per second.
+	if want := 100 * time.Second; wait < want-time.Second || wait > want+time.Second {
+		t.Errorf("wait = %v, want about %v", wait, want)
+	}
+	if ok, _ := l.AllowN("", "k", Limit{}, 1); ok {
+		t.Error("single event admitted while the bucket is in debt")
+	}
+}
+
+func TestAllowNRefusalCostsNothing(t *testing.T) {
+	global := rate.NewLimiter(1, 5)
+	global.AllowN(time.Now(), 5)
+	l := newTestLimiter(Limit{RPS: 10, Burst: 10}, global)
+
+	for _, n := range []int{1, 10, 1000} {
+		if ok, _ := l.AllowN("", "k", Limit{}, n); ok {
+			t.Fatalf("batch of %d admitted with the global bucket empty", n)
+		}
+		if got := keyTokens(l, "k"); math.Abs(got-10) > 0.1 {
+			t.Errorf("after refusing %d: key bucket has %v tokens, want 10", n, got)
+		}
+	}
+}
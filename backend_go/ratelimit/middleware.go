@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"bigdata-perf/auth"
+	"bigdata-perf/clientinfo"
+)
+
+// allowContext applies the limits for n events from ip, using the write key
+// that auth stored in ctx, for a request that already took paid tokens.
+func (l *Limiter) allowContext(ctx context.Context, ip string, n, paid int) (bool, time.Duration) {
+	k, _ := auth.FromContext(ctx)
+	keyLimit := Limit{RPS: k.RateLimit, Burst: k.Burst}
+	if keyLimit.Burst <= 0 {
+		keyLimit.Burst = max(1, int(keyLimit.RPS))
+	}
+	return l.allowN(ip, k.Key, keyLimit, n, paid)
+}
+
+// request is what the middleware leaves in the context so a handler can
+// charge for the events of a batch once it has decoded them.
+type request struct {
+	limiter *Limiter
+	ip      string
+}
+
+type contextKey struct{}
+
+// Charge takes n more tokens for the request in ctx, which already paid one
+// when it came in. Batch handlers call it with the number of events they
+// decoded less one, so a batch costs as much as its events sent one by one.
+// It allows everything when ctx did not pass through the limiter.
+func Charge(ctx context.Context, n int) (bool, time.Duration) {
+	r, ok := ctx.Value(contextKey{}).(request)
+	if !ok {
+		return true, 0
+	}
+	return r.limiter.allowContext(ctx, r.ip, n, 1)
+}
+
+// ChargeHTTP is Charge for HTTP handlers; a throttled request is answered
+// with 429 and Retry-After, and false returned.
+func ChargeHTTP(w http.ResponseWriter, r *http.Request, n int) bool {
+	ok, wait := Charge(r.Context(), n)
+	if !ok {
+		w.Header().Set("Retry-After", RetryAfter(wait))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// ChargeGRPC is Charge for gRPC handlers, returning RESOURCE_EXHAUSTED with
+// a retry-after header when the call is throttled.
+func ChargeGRPC(ctx context.Context, n int) error {
+	if ok, wait := Charge(ctx, n); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", RetryAfter(wait)))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// RetryAfter rounds wait up to whole seconds for a Retry-After header.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// clientIP returns the client IP that clientinfo resolved for the request,
+// which honours trusted proxies, or the host of remoteAddr when the request
+// did not go through clientinfo.
+func clientIP(ctx context.Context, remoteAddr string) string {
+	if info, ok := clientinfo.FromContext(ctx); ok && info.IP.IsValid() {
+		return info.IP.String()
+	}
+	return hostOnly(remoteAddr)
+}
+
+// Middleware answers throttled requests with 429 and Retry-After. It must run
+// after auth.Middleware so the write key is known, and after
+// clientinfo.Middleware for per-IP limits behind a proxy.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r.Context(), r.RemoteAddr)
+		if ok, wait := l.allowContext(r.Context(), ip, 1, 0); !ok {
+			w.Header().Set("Retry-After", RetryAfter(wait))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		ctx := context.WithValue(r.Context(), contextKey{}, request{limiter: l, ip: ip})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UnaryInterceptor fails throttled calls with RESOURCE_EXHAUSTED and a
+// retry-after header. It must be chained after the auth and clientinfo
+// interceptors.
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var remote string
+		if p, ok := peer.FromContext(ctx); ok {
+			remote = p.Addr.String()
+		}
+		ip := clientIP(ctx, remote)
+		if ok, wait := l.allowContext(ctx, ip, 1, 0); !ok {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", RetryAfter(wait)))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(context.WithValue(ctx, contextKey{}, request{limiter: l, ip: ip}), req)
+	}
+}
+
+// throttledStream takes a token for every message received, waiting while
+// the client is throttled.
+type throttledStream struct {
+	grpc.ServerStream
+	limiter *Limiter
+	ip      string
+}
+
+func (s *throttledStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	ctx := s.Context()
+	for {
+		ok, wait := s.limiter.allowContext(ctx, s.ip, 1, 0)
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// StreamInterceptor limits streaming calls per message rather than per call.
+// A throttled stream is slowed down instead of failed: the server stops
+// reading until a token is free, and flow control holds the client back. It
+// must be chained after the auth and clientinfo interceptors.
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		var remote string
+		if p, ok := peer.FromContext(ctx); ok {
+			remote = p.Addr.String()
+		}
+		return handler(srv, &throttledStream{ServerStream: ss, limiter: l, ip: clientIP(ctx, remote)})
+	}
+}
@@ -0,0 +1,185 @@
+// Package sampling decides at ingest whether to keep, drop or sample an
+// event, from rules on its event type with optional conditions on url and
+// meta. Sampling is deterministic by user id, so a sampled-in user keeps
+// their whole journey.
+package sampling
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strings"
+
+	"bigdata-perf/config"
+	ingestpb "bigdata-perf/proto"
+)
+
+// Rule actions.
+const (
+	ActionKeep   = "keep"
+	ActionDrop   = "drop"
+	ActionSample = "sample"
+)
+
+// Rule is one entry of the rules file, e.g.
+//
+//	[
+//	  {"event_type": "scroll", "action": "sample", "rate": 0.1},
+//	  {"event_type": "click", "url": "^https://internal\\.", "action": "drop"},
+//	  {"event_type": "*", "meta": {"env": "test"}, "action": "drop"}
+//	]
+//
+// Rules are checked in order and the first match applies; events matching
+// none are kept.
+type Rule struct {
+	// EventType matches exactly; "*" or empty matches any type, and a
+	// trailing * matches a prefix.
+	EventType string `json:"event_type"`
+	// URL, when set, is a regex the url must match.
+	URL string `json:"url"`
+	// Meta, when set, lists meta values that must all be equal; "*" only
+	// requires the key to be present.
+	Meta   map[string]string `json:"meta"`
+	Action string            `json:"action"`
+	// Rate is the fraction of users kept by a sample rule, in (0, 1].
+	Rate float64 `json:"rate"`
+}
+
+func (r *Rule) matches(req *ingestpb.EventRequest, url *regexp.Regexp) bool {
+	switch {
+	case r.EventType == "" || r.EventType == "*":
+	case strings.HasSuffix(r.EventType, "*"):
+		if !strings.HasPrefix(req.EventType, strings.TrimSuffix(r.EventType, "*")) {
+			return false
+		}
+	case r.EventType != req.EventType:
+		return false
+	}
+	if url != nil && !url.MatchString(req.Url) {
+		return false
+	}
+	for k, want := range r.Meta {
+		got, ok := req.Meta[k]
+		if !ok || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Decision is the outcome for one event.
+type Decision struct {
+	Keep bool
+	// Rate is the sample rate the event was kept at; 1 unless sampled.
+	Rate float64
+	// Action is the action of the matching rule, or ActionKeep.
+	Action string
+}
+
+// Sampler applies a list of rules. A nil *Sampler keeps every event.
+type Sampler struct {
+	rules []Rule
+	urls  []*regexp.Regexp
+}
+
+// FromEnv loads the rules file named by SAMPLING_RULES_FILE. It returns a nil
+// Sampler when it is unset.
+func FromEnv() (*Sampler, error) {
+	path := config.String("SAMPLING_RULES_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load reads the rules file at path.
+func Load(path string) (*Sampler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	s, err := New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	log.Printf("🎲 Loaded %d sampling rules from %s", len(rules), path)
+	return s, nil
+}
+
+// New checks and compiles rules.
+func New(rules []Rule) (*Sampler, error) {
+	s := &Sampler{rules: rules, urls: make([]*regexp.Regexp, len(rules))}
+	for i, r := range rules {
+		switch r.Action {
+		case ActionKeep, ActionDrop:
+		case ActionSample:
+			if r.Rate <= 0 || r.Rate > 1 {
+				return nil, fmt.Errorf("rule %d: sample rate must be in (0, 1], got %g", i, r.Rate)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+		if r.URL != "" {
+			re, err := regexp.Compile(r.URL)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: url: %w", i, err)
+			}
+			s.urls[i] = re
+		}
+	}
+	return s, nil
+}
+
+// Decide returns what to do with req.
+func (s *Sampler) Decide(req *ingestpb.EventRequest) Decision {
+	if s == nil {
+		return Decision{Keep: true, Rate: 1, Action: ActionKeep}
+	}
+	for i := range s.rules {
+		r := &s.rules[i]
+		if !r.matches(req, s.urls[i]) {
+			continue
+		}
+		switch r.Action {
+		case ActionDrop:
+			return Decision{Keep: false, Rate: 1, Action: ActionDrop}
+		case ActionSample:
+			return Decision{Keep: bucket(req) < r.Rate, Rate: r.Rate, Action: ActionSample}
+		}
+		return Decision{Keep: true, Rate: 1, Action: ActionKeep}
+	}
+	return Decision{Keep: true, Rate: 1, Action: ActionKeep}
+}
+
+// bucket maps the user of req to a stable point in [0, 1). Events without a
+// user id fall back to the event id, and to chance when neither is set.
+func bucket(req *ingestpb.EventRequest) float64 {
+	key := req.UserId
+	if key == "" {
+		key = req.Id
+	}
+	if key == "" {
+		return rand.Float64()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()>>11) / float64(uint64(1)<<53)
+}
+
+// StoredRate returns the rate to store for an event. Events published before
+// sampling existed carry no rate and count as unsampled.
+func StoredRate(rate float64) float64 {
+	if rate <= 0 || rate > 1 || math.IsNaN(rate) {
+		return 1
+	}
+	return rate
+}
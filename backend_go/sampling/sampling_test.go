@@ -0,0 +1,141 @@
+package sampling
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	ingestpb "bigdata-perf/proto"
+)
+
+func TestDecide(t *testing.T) {
+	s, err := New([]Rule{
+		{EventType: "heartbeat", Action: ActionDrop},
+		{EventType: "click", URL: `^https://internal\.`, Action: ActionDrop},
+		{EventType: "*", Meta: map[string]string{"env": "test"}, Action: ActionDrop},
+		{EventType: "debug_*", Meta: map[string]string{"trace": "*"}, Action: ActionKeep},
+		{EventType: "debug_*", Action: ActionDrop},
+		{EventType: "scroll", Action: ActionSample, Rate: 1},
+		{EventType: "hover", Action: ActionSample, Rate: 1e-12},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *ingestpb.EventRequest
+		want Decision
+	}{
+		{"no match keeps", &ingestpb.EventRequest{EventType: "purchase"}, Decision{Keep: true, Rate: 1, Action: ActionKeep}},
+		{"exact type dropped", &ingestpb.EventRequest{EventType: "heartbeat"}, Decision{Keep: false, Rate: 1, Action: ActionDrop}},
+		{"url matches", &ingestpb.EventRequest{EventType: "click", Url: "https://internal.example.com/"}, Decision{Keep: false, Rate: 1, Action: ActionDrop}},
+		{"url does not match", &ingestpb.EventRequest{EventType: "click", Url: "https://shop.example.com/"}, Decision{Keep: true, Rate: 1, Action: ActionKeep}},
+		{"meta value on any type", &ingestpb.EventRequest{EventType: "purchase", Meta: map[string]string{"env": "test"}}, Decision{Keep: false, Rate: 1, Action: ActionDrop}},
+		{"other meta value", &ingestpb.EventRequest{EventType: "purchase", Meta: map[string]string{"env": "prod"}}, Decision{Keep: true, Rate: 1, Action: ActionKeep}},
+		{"first match wins", &ingestpb.EventRequest{EventType: "debug_render", Meta: map[string]string{"trace": "abc"}}, Decision{Keep: true, Rate: 1, Action: ActionKeep}},
+		{"prefix without meta", &ingestpb.EventRequest{EventType: "debug_render"}, Decision{Keep: false, Rate: 1, Action: ActionDrop}},
+		{"prefix is not a substring", &ingestpb.EventRequest{EventType: "xdebug_render"}, Decision{Keep: true, Rate: 1, Action: ActionKeep}},
+		{"full rate keeps", &ingestpb.EventRequest{EventType: "scroll", UserId: "u1"}, Decision{Keep: true, Rate: 1, Action: ActionSample}},
+		{"tiny rate samples out", &ingestpb.EventRequest{EventType: "hover", UserId: "u1"}, Decision{Keep: false, Rate: 1e-12, Action: ActionSample}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Decide(tt.req); got != tt.want {
+				t.Errorf("Decide = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecideNilSampler(t *testing.T) {
+	var s *Sampler
+	want := Decision{Keep: true, Rate: 1, Action: ActionKeep}
+	if got := s.Decide(&ingestpb.EventRequest{EventType: "click"}); got != want {
+		t.Errorf("Decide = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecideSamplesPerUser(t *testing.T) {
+	s, err := New([]Rule{{EventType: "*", Action: ActionSample, Rate: 0.25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	const users = 10000
+	for i := 0; i < users; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		first := s.Decide(&ingestpb.EventRequest{EventType: "view", UserId: user, Id: "a"}).Keep
+		// Every event of a user gets the same decision.
+		if again := s.Decide(&ingestpb.EventRequest{EventType: "click", UserId: user, Id: "b"}).Keep; again != first {
+			t.Fatalf("user %s: decisions differ between events", user)
+		}
+		if first {
+			kept++
+		}
+	}
+	if got := float64(kept) / users; math.Abs(got-0.25) > 0.03 {
+		t.Errorf("kept %.3f of users, want about 0.25", got)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  *ingestpb.EventRequest
+		equal bool
+	}{
+		{"same user, different events", &ingestpb.EventRequest{UserId: "u1", Id: "e1"}, &ingestpb.EventRequest{UserId: "u1", Id: "e2"}, true},
+		{"different users", &ingestpb.EventRequest{UserId: "u1"}, &ingestpb.EventRequest{UserId: "u2"}, false},
+		{"falls back to id", &ingestpb.EventRequest{Id: "e1"}, &ingestpb.EventRequest{Id: "e1"}, true},
+		{"user id over id", &ingestpb.EventRequest{UserId: "e1", Id: "x"}, &ingestpb.EventRequest{Id: "e1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := bucket(tt.a), bucket(tt.b)
+			if a < 0 || a >= 1 || b < 0 || b >= 1 {
+				t.Fatalf("buckets %v, %v outside [0, 1)", a, b)
+			}
+			if (a == b) != tt.equal {
+				t.Errorf("bucket equal = %v, want %v (%v, %v)", a == b, tt.equal, a, b)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"unknown action", Rule{EventType: "click", Action: "skip"}},
+		{"zero rate", Rule{EventType: "click", Action: ActionSample}},
+		{"rate above one", Rule{EventType: "click", Action: ActionSample, Rate: 1.5}},
+		{"bad url regex", Rule{EventType: "click", URL: "(", Action: ActionDrop}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Rule{tt.rule}); err == nil {
+				t.Error("New accepted an invalid rule")
+			}
+		})
+	}
+}
+
+func TestStoredRate(t *testing.T) {
+	tests := []struct {
+		rate, want float64
+	}{
+		{0, 1},
+		{-1, 1},
+		{2, 1},
+		{math.NaN(), 1},
+		{0.1, 0.1},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		if got := StoredRate(tt.rate); got != tt.want {
+			t.Errorf("StoredRate(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package scrub removes personal data from events before they are published:
+// redacting meta values by key or by regex, stripping URL query parameters,
+// hashing user ids and truncating client IPs, as configured in a rules file.
+package scrub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"bigdata-perf/clientinfo"
+	"bigdata-perf/config"
+	"bigdata-perf/metrics"
+	ingestpb "bigdata-perf/proto"
+)
+
+// DefaultReplacement replaces redacted values unless the rules set another.
+const DefaultReplacement = "[REDACTED]"
+
+// Rules is the rules file, e.g.
+//
+//	{
+//	  "meta_keys": ["email", "password", "token*"],
+//	  "query_params": ["token", "access_token", "email"],
+//	  "patterns": [{"name": "email", "regex": "[\\w.+-]+@[\\w-]+\\.[\\w.-]+"}],
+//	  "hash_user_id": true,
+//	  "ipv4_prefix": 24,
+//	  "ipv6_prefix": 48
+//	}
+//
+// Key and parameter names match case-insensitively; a trailing * matches any
+// suffix.
+type Rules struct {
+	// DryRun reports what would be scrubbed without changing events.
+	DryRun      bool   `json:"dry_run"`
+	Replacement string `json:"replacement"`
+	// MetaKeys are meta keys whose values are always redacted.
+	MetaKeys []string `json:"meta_keys"`
+	// QueryParams are removed from url and referrer.
+	QueryParams []string `json:"query_params"`
+	// Patterns are redacted wherever they match in meta values, url and
+	// referrer.
+	Patterns []Pattern `json:"patterns"`
+	// HashUserID replaces user_id with its HMAC-SHA256 under the salt from
+	// SCRUB_USER_ID_SALT, so the same user keeps the same id.
+	HashUserID bool `json:"hash_user_id"`
+	// IPv4Prefix and IPv6Prefix truncate client_ip to that many bits.
+	IPv4Prefix int `json:"ipv4_prefix"`
+	IPv6Prefix int `json:"ipv6_prefix"`
+}
+
+// Pattern is a named regular expression to redact.
+type Pattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+}
+
+// Finding is one value a rule matched.
+type Finding struct {
+	Rule  string
+	Field string
+}
+
+func (f Finding) String() string {
+	return f.Rule + " on " + f.Field
+}
+
+type pattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Scrubber applies a set of rules. A nil *Scrubber leaves events unchanged.
+type Scrubber struct {
+	rules       Rules
+	metaKeys    matcher
+	queryParams matcher
+	patterns    []pattern
+	salt        []byte
+}
+
+// FromEnv loads the rules file named by SCRUB_RULES_FILE, with the user id
+// salt from SCRUB_USER_ID_SALT. It returns a nil Scrubber when no rules file
+// is set.
+func FromEnv() (*Scrubber, error) {
+	path := config.String("SCRUB_RULES_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path, os.Getenv("SCRUB_USER_ID_SALT"))
+}
+
+// Load reads the rules file at path.
+func Load(path, salt string) (*Scrubber, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	s, err := New(rules, salt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	mode := ""
+	if rules.DryRun {
+		mode = " (dry run)"
+	}
+	log.Printf("🧹 Loaded scrub rules from %s%s", path, mode)
+	return s, nil
+}
+
+// New compiles rules.
+func New(rules Rules, salt string) (*Scrubber, error) {
+	if rules.HashUserID && salt == "" {
+		return nil, errors.New("hash_user_id requires SCRUB_USER_ID_SALT")
+	}
+	if rules.Replacement == "" {
+		rules.Replacement = DefaultReplacement
+	}
+	s := &Scrubber{
+		rules:       rules,
+		metaKeys:    newMatcher(rules.MetaKeys),
+		queryParams: newMatcher(rules.QueryParams),
+		salt:        []byte(salt),
+	}
+	for i, p := range rules.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p.Name, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("pattern %d", i)
+		}
+		s.patterns = append(s.patterns, pattern{name: name, re: re})
+	}
+	return s, nil
+}
+
+// Apply scrubs req in place and returns what it matched. In dry-run mode req
+// is left untouched and the findings are only logged.
+func (s *Scrubber) Apply(req *ingestpb.EventRequest) []Finding {
+	if s == nil {
+		return nil
+	}
+	target := req
+	if s.rules.DryRun {
+		target = proto.Clone(req).(*ingestpb.EventRequest)
+	}
+
+	var findings []Finding
+	found := func(rule, field string) {
+		findings = append(findings, Finding{Rule: rule, Field: field})
+		metrics.ScrubMatches.WithLabelValues(rule).Inc()
+	}
+
+	if s.rules.HashUserID && target.UserId != "" {
+		mac := hmac.New(sha256.New, s.salt)
+		mac.Write([]byte(target.UserId))
+		target.UserId = hex.EncodeToString(mac.Sum(nil))
+		found("hash_user_id", "user_id")
+	}
+
+	for k, v := range target.Meta {
+		if s.metaKeys.match(k) {
+			target.Meta[k] = s.rules.Replacement
+			found("meta_key", "meta."+k)
+			continue
+		}
+		target.Meta[k] = s.redact(v, "meta."+k, found)
+	}
+
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"url", &target.Url}, {"referrer", &target.Referrer}} {
+		*f.value = s.stripQuery(*f.value, f.name, found)
+		*f.value = s.redact(*f.value, f.name, found)
+	}
+
+	// The pipeline scrubs after enrichment, so GeoIP has already looked up
+	// the full address.
+	if s.rules.IPv4Prefix > 0 || s.rules.IPv6Prefix > 0 {
+		if ip, err := netip.ParseAddr(target.ClientIp); err == nil {
+			v4, v6 := s.rules.IPv4Prefix, s.rules.IPv6Prefix
+			if v4 <= 0 {
+				v4 = 32
+			}
+			if v6 <= 0 {
+				v6 = 128
+			}
+			if truncated := clientinfo.Truncate(ip, v4, v6); truncated != ip {
+				target.ClientIp = truncated.String()
+				found("ip_prefix", "client_ip")
+			}
+		}
+	}
+
+	if s.rules.DryRun && len(findings) > 0 {
+		log.Printf("🧪 Scrub dry run, would change event %s: %v", req.Id, findings)
+	}
+	return findings
+}
+
+// redact replaces every pattern match in value.
+func (s *Scrubber) redact(value, field string, found func(rule, field string)) string {
+	for _, p := range s.patterns {
+		if p.re.MatchString(value) {
+			value = p.re.ReplaceAllLiteralString(value, s.rules.Replacement)
+			found(p.name, field)
+		}
+	}
+	return value
+}
+
+// stripQuery removes the configured query parameters from raw, leaving it
+// untouched when none is present or it does not parse.
+func (s *Scrubber) stripQuery(raw, field string, found func(rule, field string)) string {
+	if len(s.queryParams) == 0 || !strings.Contains(raw, "?") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	removed := false
+	for name := range q {
+		if s.queryParams.match(name) {
+			q.Del(name)
+			found("query_param", field+"?"+name)
+			removed = true
+		}
+	}
+	if !removed {
+		return raw
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// matcher matches names case-insensitively; an entry ending in * matches
+// any name with that prefix.
+type matcher []string
+
+func newMatcher(names []string) matcher {
+	m := make(matcher, 0, len(names))
+	for _, n := range names {
+		m = append(m, strings.ToLower(n))
+	}
+	return m
+}
+
+func (m matcher) match(name string) bool {
+	name = strings.ToLower(name)
+	for _, entry := range m {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
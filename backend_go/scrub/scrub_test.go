@@ -0,0 +1,45 @@
+package scrub
+
+import (
+	"reflect"
+	"testing"
+
+	ingestpb "bigdata-perf/proto"
+)
+
+func TestApplyTruncatesClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  Rules
+		ip     string
+		want   string
+		report bool
+	}{
+		{"ipv4", Rules{IPv4Prefix: 24, IPv6Prefix: 48}, "203.0.113.57", "203.0.113.0", true},
+		{"ipv6", Rules{IPv4Prefix: 24, IPv6Prefix: 48}, "2001:db8:abcd:12::1", "2001:db8:abcd::", true},
+		{"only ipv4 set keeps ipv6", Rules{IPv4Prefix: 24}, "2001:db8:abcd:12::1", "2001:db8:abcd:12::1", false},
+		{"already truncated", Rules{IPv4Prefix: 24}, "203.0.113.0", "203.0.113.0", false},
+		{"no ip", Rules{IPv4Prefix: 24}, "", "", false},
+		{"dry run reports but keeps", Rules{DryRun: true, IPv4Prefix: 16}, "203.0.113.57", "203.0.113.57", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.rules, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &ingestpb.EventRequest{Id: "e1", ClientIp: tt.ip}
+			findings := s.Apply(req)
+			if req.ClientIp != tt.want {
+				t.Errorf("client_ip = %q, want %q", req.ClientIp, tt.want)
+			}
+			var want []Finding
+			if tt.report {
+				want = []Finding{{Rule: "ip_prefix", Field: "client_ip"}}
+			}
+			if !reflect.DeepEqual(findings, want) {
+				t.Errorf("findings = %v, want %v", findings, want)
+			}
+		})
+	}
+}
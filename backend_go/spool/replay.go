@@ -0,0 +1,168 @@
+package spool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"bigdata-perf/metrics"
+)
+
+// Replay backoff bounds, as for broker reconnects.
+const (
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+// PublishFunc publishes one spooled message and waits for the broker to take
+// it.
+type PublishFunc func(ctx context.Context, key string, body []byte) error
+
+// PermanentFunc returns why a publish error will not go away on retry, such
+// as "unroutable" for a routing key nothing is bound to, or "" when the
+// publish should be retried.
+type PermanentFunc func(err error) string
+
+// Run replays spooled events through publish until ctx is done. It waits for
+// ready to pass before starting on a segment, publishes records in the order
+// they were written, retrying each until it is confirmed, and deletes a
+// segment once all of it is through. A record whose error permanent gives a
+// reason for is dropped and counted under that reason instead, so it cannot
+// hold up the records behind it. A segment interrupted by shutdown is
+// replayed from the start on the next run, so a few events may be published
+// twice; they keep their id, so ClickHouse collapses them.
+func (s *Spool) Run(ctx context.Context, ready func(context.Context) error, publish PublishFunc, permanent PermanentFunc) {
+	if s == nil {
+		return
+	}
+	for {
+		if ready(ctx) == nil {
+			if seg, ok := s.next(); ok {
+				if err := s.replay(ctx, seg, publish, permanent); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// next takes the oldest segment off the replay queue, sealing the active
+// segment first when it is the only one with events.
+func (s *Spool) next() (segment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sealed) == 0 && s.activeEvents > 0 {
+		s.seal()
+	}
+	if len(s.sealed) == 0 {
+		return segment{}, false
+	}
+	seg := s.sealed[0]
+	s.sealed = s.sealed[1:]
+	return seg, true
+}
+
+// replay publishes every record of seg and removes it. It only fails when
+// ctx is done, in which case seg is put back at the head of the queue.
+func (s *Spool) replay(ctx context.Context, seg segment, publish PublishFunc, permanent PermanentFunc) error {
+	path := segmentPath(s.cfg.Dir, seg.seq)
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("❌ Opening spool segment failed: %v", err)
+		s.finish(seg, seg.events)
+		return nil
+	}
+	defer f.Close()
+
+	log.Printf("📤 Replaying %d spooled events from %s", seg.events, path)
+	r := bufio.NewReader(f)
+	done, dropped := 0, 0
+	for {
+		key, body, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("⚠️  Skipping the rest of %s: %v", path, err)
+			break
+		}
+
+		delay := minRetryDelay
+		reason := ""
+		for {
+			err := publish(ctx, key, body)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				s.requeue(seg, done)
+				return ctx.Err()
+			}
+			if reason = permanent(err); reason != "" {
+				log.Printf("❌ Dropping spooled event for %q: %v", key, err)
+				break
+			}
+			log.Printf("⚠️  Spool replay publish failed, retrying in %s: %v", delay, err)
+			select {
+			case <-ctx.Done():
+				s.requeue(seg, done)
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRetryDelay)
+		}
+		done++
+		if reason != "" {
+			dropped++
+			metrics.SpoolDropped.WithLabelValues(s.name, reason).Inc()
+		} else {
+			metrics.SpoolReplayed.WithLabelValues(s.name).Inc()
+		}
+		s.mu.Lock()
+		s.events--
+		s.updateGauges()
+		s.mu.Unlock()
+	}
+
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		log.Printf("⚠️  Removing spool segment failed: %v", err)
+	}
+	s.finish(seg, seg.events-done)
+	log.Printf("✅ Replayed %d spooled events", done-dropped)
+	return nil
+}
+
+// finish accounts for a removed segment of which unreplayed events were not
+// published (unreadable or corrupt).
+func (s *Spool) finish(seg segment, unreplayed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes -= seg.size
+	s.events -= max(0, unreplayed)
+	if unreplayed > 0 {
+		metrics.SpoolDropped.WithLabelValues(s.name, "corrupt").Add(float64(unreplayed))
+	}
+	s.updateGauges()
+}
+
+// requeue puts an interrupted segment back at the head of the queue. Its
+// replayed events count as pending again, since they will be replayed.
+func (s *Spool) requeue(seg segment, replayed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed = append([]segment{seg}, s.sealed...)
+	s.events += replayed
+	s.updateGauges()
+}
@@ -0,0 +1,133 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Segment files are named by a sequence number so they sort in write order.
+const segmentExt = ".seg"
+
+// A record is a 4-byte big-endian payload length, the CRC-32 of the payload,
+// then the payload: a 1-byte routing key length, the routing key and the
+// message body.
+const recordHeaderLen = 8
+
+// maxRecordLen rejects absurd lengths from a damaged header before
+// allocating for them.
+const maxRecordLen = 64 << 20
+
+// errCorrupt marks a record that was cut short or fails its checksum,
+// typically the last write before a crash.
+var errCorrupt = errors.New("corrupt spool record")
+
+// segment is a closed segment file waiting to be replayed.
+type segment struct {
+	seq    uint64
+	size   int64
+	events int
+}
+
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// listSegments returns the segment files in dir, oldest first, with their
+// record counts.
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []segment
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		events, err := countRecords(segmentPath(dir, seq))
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{seq: seq, size: info.Size(), events: events})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+func encodeRecord(key string, body []byte) ([]byte, error) {
+	if len(key) > 255 {
+		return nil, fmt.Errorf("routing key too long: %q", key)
+	}
+	payloadLen := 1 + len(key) + len(body)
+	rec := make([]byte, recordHeaderLen+payloadLen)
+	payload := rec[recordHeaderLen:]
+	payload[0] = byte(len(key))
+	copy(payload[1:], key)
+	copy(payload[1+len(key):], body)
+	binary.BigEndian.PutUint32(rec[0:4], uint32(payloadLen))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	return rec, nil
+}
+
+// readRecord reads the next record from r. It returns io.EOF at a clean end
+// of the segment and errCorrupt for a damaged or truncated record.
+func readRecord(r *bufio.Reader) (key string, body []byte, err error) {
+	var header [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return "", nil, io.EOF
+		}
+		return "", nil, errCorrupt
+	}
+	n := binary.BigEndian.Uint32(header[0:4])
+	if n > maxRecordLen {
+		return "", nil, errCorrupt
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, errCorrupt
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) || len(payload) < 1 {
+		return "", nil, errCorrupt
+	}
+	klen := int(payload[0])
+	if len(payload) < 1+klen {
+		return "", nil, errCorrupt
+	}
+	return string(payload[1 : 1+klen]), payload[1+klen:], nil
+}
+
+func countRecords(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	n := 0
+	for {
+		if _, _, err := readRecord(r); err != nil {
+			// A corrupt tail is reported when the segment is replayed.
+			return n, nil
+		}
+		n++
+	}
+}
@@ -0,0 +1,143 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		body []byte
+	}{
+		{"event", "event.click", []byte("payload")},
+		{"empty body", "event.view", nil},
+		{"empty key", "", []byte{0, 1, 2}},
+		{"longest key", strings.Repeat("k", 255), []byte("x")},
+		{"binary body", "quarantine.purchase", bytes.Repeat([]byte{0xff, 0x00}, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := encodeRecord(tt.key, tt.body)
+			if err != nil {
+				t.Fatalf("encodeRecord: %v", err)
+			}
+			r := bufio.NewReader(bytes.NewReader(rec))
+			key, body, err := readRecord(r)
+			if err != nil {
+				t.Fatalf("readRecord: %v", err)
+			}
+			if key != tt.key || !bytes.Equal(body, tt.body) {
+				t.Errorf("got (%q, %q), want (%q, %q)", key, body, tt.key, tt.body)
+			}
+			if _, _, err := readRecord(r); !errors.Is(err, io.EOF) {
+				t.Errorf("after last record: err = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestEncodeRecordKeyTooLong(t *testing.T) {
+	if _, err := encodeRecord(strings.Repeat("k", 256), nil); err == nil {
+		t.Fatal("encodeRecord accepted a 256-byte routing key")
+	}
+}
+
+func TestReadRecordCorrupt(t *testing.T) {
+	rec, err := encodeRecord("event.click", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	damage := func(f func(b []byte)) []byte {
+		b := append([]byte(nil), rec...)
+		f(b)
+		return b
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, io.EOF},
+		{"short header", rec[:5], errCorrupt},
+		{"short payload", rec[:len(rec)-1], errCorrupt},
+		{"bad checksum", damage(func(b []byte) { b[len(b)-1] ^= 1 }), errCorrupt},
+		{"absurd length", damage(func(b []byte) { b[0] = 0xff }), errCorrupt},
+		{"key longer than payload", encodeRaw([]byte{200, 'a'}), errCorrupt},
+		{"zero length payload", encodeRaw(nil), errCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readRecord(bufio.NewReader(bytes.NewReader(tt.data)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// encodeRaw frames payload with a valid length and checksum, whatever it
+// holds.
+func encodeRaw(payload []byte) []byte {
+	rec := make([]byte, recordHeaderLen, recordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	return append(rec, payload...)
+}
+
+func writeSegment(t *testing.T, dir string, seq uint64, records int, tail []byte) {
+	t.Helper()
+	var data []byte
+	for i := 0; i < records; i++ {
+		rec, err := encodeRecord("event.click", []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, rec...)
+	}
+	data = append(data, tail...)
+	if err := os.WriteFile(segmentPath(dir, seq), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSegments(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, 12, 3, nil)
+	writeSegment(t, dir, 2, 1, nil)
+	writeSegment(t, dir, 7, 2, []byte{0, 0, 0}) // torn last write
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(dir, "abc"+segmentExt), []byte("x"), 0o644)
+	os.Mkdir(filepath.Join(dir, "00000000000000000099"+segmentExt), 0o755)
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		seq    uint64
+		events int
+	}{{2, 1}, {7, 2}, {12, 3}}
+	if len(segments) != len(want) {
+		t.Fatalf("got %d segments, want %d: %+v", len(segments), len(want), segments)
+	}
+	for i, w := range want {
+		if segments[i].seq != w.seq || segments[i].events != w.events {
+			t.Errorf("segment %d = %+v, want seq %d with %d events", i, segments[i], w.seq, w.events)
+		}
+		info, _ := os.Stat(segmentPath(dir, w.seq))
+		if segments[i].size != info.Size() {
+			t.Errorf("segment %d size = %d, want %d", i, segments[i].size, info.Size())
+		}
+	}
+}
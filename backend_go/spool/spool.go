@@ -0,0 +1,209 @@
+// Package spool is a write-ahead spool on local disk for events that could
+// not be published because the broker was unavailable. Events are appended to
+// segment files and replayed to the broker, in order, once it is back.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"bigdata-perf/config"
+	"bigdata-perf/metrics"
+)
+
+// ErrFull is returned by Append when the spool is at its size limit and the
+// overflow policy is OverflowReject.
+var ErrFull = errors.New("spool is full")
+
+// Overflow policies, applied when an append would exceed MaxBytes.
+const (
+	// OverflowReject refuses the new event; the caller sees the broker
+	// error as if there were no spool.
+	OverflowReject = "reject"
+	// OverflowDropOldest deletes the oldest segments not yet being replayed
+	// to make room.
+	OverflowDropOldest = "drop_oldest"
+)
+
+// Config sizes a spool.
+type Config struct {
+	Dir          string
+	SegmentBytes int64
+	MaxBytes     int64
+	Overflow     string
+}
+
+// FromEnv opens the spool of the service called name, in its own
+// subdirectory of SPOOL_DIR. It returns a nil Spool, disabling spooling, when
+// SPOOL_DIR is unset.
+func FromEnv(name string) (*Spool, error) {
+	dir := config.String("SPOOL_DIR", "")
+	if dir == "" {
+		log.Println("⚠️  SPOOL_DIR not set, events are not spooled while the broker is down")
+		return nil, nil
+	}
+	cfg := Config{
+		Dir:          filepath.Join(dir, name),
+		SegmentBytes: int64(config.Int("SPOOL_SEGMENT_BYTES", 8<<20)),
+		MaxBytes:     int64(config.Int("SPOOL_MAX_BYTES", 1<<30)),
+		Overflow:     config.String("SPOOL_OVERFLOW", OverflowReject),
+	}
+	if cfg.Overflow != OverflowReject && cfg.Overflow != OverflowDropOldest {
+		log.Printf("⚠️  Invalid SPOOL_OVERFLOW=%q, defaulting to %s", cfg.Overflow, OverflowReject)
+		cfg.Overflow = OverflowReject
+	}
+	return Open(name, cfg)
+}
+
+// Spool appends events to the active segment and hands closed segments to
+// the replayer, oldest first. A nil *Spool does nothing.
+type Spool struct {
+	cfg  Config
+	name string
+
+	mu           sync.Mutex
+	active       *os.File
+	activeSeq    uint64
+	activeSize   int64
+	activeEvents int
+	// sealed are closed segments waiting for replay, oldest first. The
+	// segment being replayed is no longer in it.
+	sealed []segment
+	bytes  int64
+	events int
+
+	// notify wakes the replayer after an append.
+	notify chan struct{}
+}
+
+// Open opens the spool in cfg.Dir, picking up segments left by a previous
+// run. name labels the spool's metrics.
+func Open(name string, cfg Config) (*Spool, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("scan spool %s: %w", cfg.Dir, err)
+	}
+	s := &Spool{cfg: cfg, name: name, sealed: segments, notify: make(chan struct{}, 1)}
+	for _, seg := range segments {
+		s.bytes += seg.size
+		s.events += seg.events
+		s.activeSeq = seg.seq
+	}
+	s.updateGauges()
+	if s.events > 0 {
+		log.Printf("📦 Spool %s has %d events (%d bytes) left to replay", cfg.Dir, s.events, s.bytes)
+	}
+	return s, nil
+}
+
+// Append durably writes body, to be published with routing key, to the
+// spool.
+func (s *Spool) Append(key string, body []byte) error {
+	rec, err := encodeRecord(key, body)
+	if err != nil {
+		return err
+	}
+	size := int64(len(rec))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.bytes+size > s.cfg.MaxBytes {
+		if s.cfg.Overflow == OverflowDropOldest && len(s.sealed) == 0 {
+			s.seal()
+		}
+		if s.cfg.Overflow != OverflowDropOldest || len(s.sealed) == 0 {
+			metrics.SpoolDropped.WithLabelValues(s.name, "full").Inc()
+			return ErrFull
+		}
+		s.dropOldest()
+	}
+
+	if s.active != nil && s.activeSize+size > s.cfg.SegmentBytes {
+		s.seal()
+	}
+	if s.active == nil {
+		s.activeSeq++
+		f, err := os.OpenFile(segmentPath(s.cfg.Dir, s.activeSeq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.active, s.activeSize, s.activeEvents = f, 0, 0
+	}
+
+	if _, err := s.active.Write(rec); err != nil {
+		// Start a fresh segment so later records do not follow a torn one.
+		s.seal()
+		return err
+	}
+	if err := s.active.Sync(); err != nil {
+		s.seal()
+		return err
+	}
+	s.activeSize += size
+	s.activeEvents++
+	s.bytes += size
+	s.events++
+	s.updateGauges()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close closes the active segment. Unreplayed events stay on disk for the
+// next run.
+func (s *Spool) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// seal closes the active segment and queues it for replay. Callers hold mu.
+func (s *Spool) seal() {
+	if s.active == nil {
+		return
+	}
+	if err := s.active.Close(); err != nil {
+		log.Printf("⚠️  Closing spool segment failed: %v", err)
+	}
+	s.sealed = append(s.sealed, segment{seq: s.activeSeq, size: s.activeSize, events: s.activeEvents})
+	s.active = nil
+}
+
+// dropOldest deletes the oldest sealed segment. Callers hold mu.
+func (s *Spool) dropOldest() {
+	seg := s.sealed[0]
+	s.sealed = s.sealed[1:]
+	if err := os.Remove(segmentPath(s.cfg.Dir, seg.seq)); err != nil {
+		log.Printf("⚠️  Removing spool segment failed: %v", err)
+	}
+	s.bytes -= seg.size
+	s.events -= seg.events
+	metrics.SpoolDropped.WithLabelValues(s.name, "overflow").Add(float64(seg.events))
+	log.Printf("⚠️  Spool full, dropped %d oldest events", seg.events)
+	s.updateGauges()
+}
+
+// updateGauges publishes the spool depth. Callers hold mu.
+func (s *Spool) updateGauges() {
+	metrics.SpoolEvents.WithLabelValues(s.name).Set(float64(s.events))
+	metrics.SpoolBytes.WithLabelValues(s.name).Set(float64(s.bytes))
+}
@@ -0,0 +1,202 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"bigdata-perf/metrics"
+)
+
+func testConfig(dir string) Config {
+	return Config{Dir: dir, SegmentBytes: 64, MaxBytes: 1 << 20, Overflow: OverflowReject}
+}
+
+func appendEvents(t *testing.T, s *Spool, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.Append("event.click", []byte{byte(i)}); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+}
+
+func TestOpenRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test", testConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, s, 10)
+	size, seq := s.bytes, s.activeSeq
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open("test", testConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.events != 10 || s.bytes != size {
+		t.Errorf("reopened with %d events, %d bytes; want 10, %d", s.events, s.bytes, size)
+	}
+	if len(s.sealed) < 2 {
+		t.Errorf("got %d segments, want the events split over several", len(s.sealed))
+	}
+	if s.activeSeq != seq {
+		t.Errorf("activeSeq = %d, want %d so new segments sort after the old", s.activeSeq, seq)
+	}
+
+	// New appends must not overwrite a recovered segment.
+	appendEvents(t, s, 1)
+	if s.activeSeq <= seq {
+		t.Errorf("new segment %d reuses a recovered sequence number", s.activeSeq)
+	}
+}
+
+func TestAppendOverflow(t *testing.T) {
+	rec, _ := encodeRecord("event.click", []byte{0})
+	size := int64(len(rec))
+
+	tests := []struct {
+		name       string
+		overflow   string
+		appends    int
+		wantErr    error
+		wantEvents int
+	}{
+		{"reject when full", OverflowReject, 5, ErrFull, 4},
+		{"drop oldest", OverflowDropOldest, 6, nil, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Dir: t.TempDir(), SegmentBytes: 2 * size, MaxBytes: 4 * size, Overflow: tt.overflow}
+			s, err := Open("test", cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			for i := 0; i < tt.appends; i++ {
+				err = s.Append("event.click", []byte{byte(i)})
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("last Append err = %v, want %v", err, tt.wantErr)
+			}
+			if s.events != tt.wantEvents || s.bytes > cfg.MaxBytes {
+				t.Errorf("spool holds %d events, %d bytes; want %d events within %d bytes", s.events, s.bytes, tt.wantEvents, cfg.MaxBytes)
+			}
+		})
+	}
+}
+
+func TestRunReplaysInOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test", testConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	appendEvents(t, s, 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var got []byte
+	failed := false
+	publish := func(ctx context.Context, key string, body []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			// The broker refuses the first attempt; it must be retried.
+			failed = true
+			return errors.New("broker down")
+		}
+		got = append(got, body...)
+		if len(got) == 20 {
+			cancel()
+		}
+		return nil
+	}
+	runUntilCancelled(t, ctx, s, publish, func(error) string { return "" })
+
+	for i, b := range got {
+		if int(b) != i {
+			t.Fatalf("replayed out of order: %v", got)
+		}
+	}
+	if len(got) != 20 {
+		t.Fatalf("replayed %d events, want 20", len(got))
+	}
+	entries, _ := os.ReadDir(dir)
+	if s.events != 0 || len(entries) > 1 {
+		t.Errorf("after replay: %d events pending, %d files left", s.events, len(entries))
+	}
+}
+
+// runUntilCancelled runs s.Run until publish cancels ctx.
+func runUntilCancelled(t *testing.T, ctx context.Context, s *Spool, publish PublishFunc, permanent PermanentFunc) {
+	t.Helper()
+	ready := func(context.Context) error { return nil }
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, ready, publish, permanent)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+}
+
+func TestRunDropsPermanentFailures(t *testing.T) {
+	errUnroutable := errors.New("unroutable")
+	s, err := Open("test-permanent", testConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	appendEvents(t, s, 10)
+	dropped := metrics.SpoolDropped.WithLabelValues("test-permanent", "unroutable")
+	before := testutil.ToFloat64(dropped)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []byte
+	attempts := 0
+	publish := func(ctx context.Context, key string, body []byte) error {
+		attempts++
+		if body[0]%3 == 0 && body[0] < 9 {
+			// Events 0, 3 and 6 have no binding; retrying cannot help.
+			return errUnroutable
+		}
+		got = append(got, body...)
+		if body[0] == 9 {
+			cancel()
+		}
+		return nil
+	}
+	permanent := func(err error) string {
+		if errors.Is(err, errUnroutable) {
+			return "unroutable"
+		}
+		return ""
+	}
+	runUntilCancelled(t, ctx, s, publish, permanent)
+
+	if want := []byte{1, 2, 4, 5, 7, 8, 9}; string(got) != string(want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if attempts != 10 {
+		t.Errorf("%d publish attempts, want 10: unroutable events must not be retried", attempts)
+	}
+	if n := testutil.ToFloat64(dropped) - before; n != 3 {
+		t.Errorf("counted %v unroutable drops, want 3", n)
+	}
+}